@@ -0,0 +1,426 @@
+package main
+
+import (
+    "errors"
+    "flag"
+    "fmt"
+    "log/slog"
+    "os"
+    "strings"
+    "time"
+
+    "sonarcheck/pkg/artifactory"
+    "sonarcheck/pkg/config"
+    "sonarcheck/pkg/exitcode"
+    "sonarcheck/pkg/logging"
+    "sonarcheck/pkg/policy"
+    "sonarcheck/pkg/report"
+    "sonarcheck/pkg/sonarqube"
+    "sonarcheck/pkg/utils"
+    "sonarcheck/pkg/waiver"
+)
+
+// Check the SonarQube status of every component, publish and promote the result if asked to
+func runCheck(fs *flag.FlagSet, args []string) {
+    verifyFlag := fs.Bool("verify", false, "Verify the gate result published on the umbrella chart instead of running a check")
+    promoteFlag := fs.Bool("promote", false, "Promote the umbrella chart (or build) if every component passes")
+    printConfigFlag := fs.Bool("print-config", false, "Print the resolved config with secrets redacted and exit, same as the config command")
+    started := time.Now()
+    parseFlags(fs, args)
+    if fs.Arg(0) != "" {
+        config.IgnoreRules = fs.Arg(0)
+    }
+
+    if *printConfigFlag {
+        if err := config.Print(os.Stdout); err != nil {
+            exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+        }
+        return
+    }
+    prepare(!*verifyFlag)
+    if *promoteFlag && config.PromoteTargetRepo == "" {
+        exitcode.Fatalf(exitcode.ConfigError, "PROMOTE_TARGET_REPO environment variable not set")
+    }
+
+    jfrogClient, chart := newJfrogClient()
+
+    // Read back the properties of a previous check instead of running a new one
+    if *verifyFlag {
+        properties, err := jfrogClient.VerifyChartProperties(chart)
+        for key, values := range properties {
+            slog.Debug("Published property", "key", key, "values", values)
+        }
+        if errors.Is(err, artifactory.ErrGateNotPassed) {
+            exitcode.Fatalf(exitcode.GateFailed, "%v", err)
+        } else if err != nil {
+            exitcode.Fatalf(exitcode.Unavailable, "%v", err)
+        }
+        slog.Info("Passed the SonarQube status check", "chart", chart.String())
+        return
+    }
+
+    ignoreRules := config.IgnoreRules
+
+    // Check SonarQube and JFrog server availability
+    sonarServer := connectSonarQube()
+    checkArtifactory(jfrogClient)
+
+    discoverStarted := time.Now()
+    components, digest := discoverComponents(jfrogClient, chart)
+    if *promoteFlag {
+        if err := checkPromotable(chart); err != nil {
+            utils.CleanWorkingDirectory(config.CleaningPattern)
+            exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+        }
+    }
+    checkReport := newReport(chart, digest, sonarServer, started)
+    checkReport.Timings.DiscoverMs = time.Since(discoverStarted).Milliseconds()
+
+    // Check SonarQube status for each component
+    var results []policy.ComponentResult
+    waivers := make(map[string]*waiver.Waiver)
+    now := time.Now()
+    for _, component := range components {
+        dependency, version := component.Name, component.Version
+        componentStarted := time.Now()
+
+        // Per-component overrides from the config file
+        override := config.FindOverride(dependency)
+        if override != nil && override.Version != "" {
+            version = override.Version
+        }
+        logger := logging.Component(dependency, version)
+        result := policy.ComponentResult{Component: component, Version: version, Severity: policy.SeveritySkipped}
+
+        // Waivers in force skip the check, expired ones only leave a warning behind
+        w, expired := waiver.Find(config.Waivers, dependency, version, now)
+        for _, e := range expired {
+            logger.Warn("Waiver expired, checking it again", "waiver", e.Pattern, "expires", e.Expires, "details", e.String())
+        }
+        if w != nil {
+            logger.Debug("Waived", "waiver", w.Pattern, "details", w.String())
+            waivers[dependency] = w
+            result.Status = "Waived"
+            result.Duration = time.Since(componentStarted)
+            results = append(results, result)
+            continue
+        }
+
+        // Check if there is an ignore rule for a dependency
+        match, err := utils.CompareWithRegex(ignoreRules, dependency)
+        if override != nil && override.Ignore {
+            match = true
+        }
+        if err != nil {
+            logger.Error("Matching ignore rules", "error", err)
+            continue
+        } else if match {
+            logger.Debug("Ignored", "ignoreRules", ignoreRules)
+            result.Status = "Ignored"
+            result.Duration = time.Since(componentStarted)
+            results = append(results, result)
+            continue
+        }
+
+        // Library and third-party charts have no Sonarqube project
+        if utils.IsLibraryChart(component) {
+            logger.Debug("Skipped, library chart")
+            result.Status = "Library"
+            result.Duration = time.Since(componentStarted)
+            results = append(results, result)
+            continue
+        }
+        if !utils.IsInternalComponent(component, config.InternalOrigins) {
+            logger.Info("External, not checked")
+            result.Status = "External"
+            result.Duration = time.Since(componentStarted)
+            results = append(results, result)
+            continue
+        }
+
+        // The policy of the component decides how its analysis counts
+        componentPolicy := config.FindPolicy(component)
+        result.Labels = componentPolicy.Labels
+
+        // Without a version there is no analysis to compare against
+        if version == "" {
+            result.Status = utils.StatusNoVersion
+            result.Severity, result.Violations = policy.LogStatus(dependency, version, sonarqube.Analysis{}, componentPolicy)
+            result.Duration = time.Since(componentStarted)
+            results = append(results, result)
+            continue
+        }
+
+        // Find the project key for the dependency, unless the config file pins it
+        projectKey, resolvedBy := "", "config override"
+        if override != nil && override.ProjectKey != "" {
+            projectKey = override.ProjectKey
+        } else {
+            projectKey, err = sonarqube.FindProjectKey(dependency, sonarServer)
+            resolvedBy = "component search"
+        }
+        if err != nil {
+            logger.Warn("No SonarQube project found", "error", err)
+            result.Status = "NotFound"
+            result.Severity = failSeverity(componentPolicy)
+            result.Duration = time.Since(componentStarted)
+            results = append(results, result)
+            continue
+        }
+        result.ProjectKey, result.ResolvedBy = projectKey, resolvedBy
+
+        // Check the SonarQube scan status of the dependency
+        analysis, err := sonarqube.SonarCheck(projectKey, version, componentPolicy.Branch, sonarServer)
+        if err != nil {
+            logger.Error("Querying SonarQube", "projectKey", projectKey, "error", err)
+            result.Status = "Error"
+            result.Severity = failSeverity(componentPolicy)
+            result.Duration = time.Since(componentStarted)
+            results = append(results, result)
+            continue
+        }
+
+        // Log the status of SonarQube check
+        result.Analysis = analysis
+        result.Status = string(analysis.Status)
+        result.Severity, result.Violations = policy.LogStatus(dependency, version, analysis, componentPolicy)
+        result.Duration = time.Since(componentStarted)
+        results = append(results, result)
+    }
+
+    // The decision rules may change the severity of each component, then decide over all of them
+    failed, err := config.Decision.Apply(results, now)
+    if err != nil {
+        utils.CleanWorkingDirectory(config.CleaningPattern)
+        exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+    }
+    for _, result := range results {
+        logging.Component(result.Component.Name, result.Version).Debug("Decided", "severity", result.Severity)
+    }
+
+    checkReport.Timings.CheckMs = time.Since(now).Milliseconds()
+
+    // Every waiver that excused a component is listed, so they can be audited
+    for _, result := range results {
+        if w := waivers[result.Component.Name]; w != nil {
+            logging.Component(result.Component.Name, result.Version).Info("Waived", "waiver", w.Pattern, "details", w.String())
+        }
+    }
+
+    // Write the reports before publishing and promoting, they describe the check itself
+    checkReport.AddResults(results, waivers)
+    checkReport.Finish(failed)
+    writeReports(checkReport)
+
+    // Publish the result onto the umbrella chart so promotion can query it later
+    if config.PublishProperties {
+        if config.DependencySource != config.SourceChart {
+            slog.Warn("Publishing properties needs the chart source, skipped")
+        } else {
+            properties := map[string]string{
+                artifactory.PropertyStatus:    "passed",
+                artifactory.PropertyTimestamp: time.Now().UTC().Format(time.RFC3339),
+            }
+            if failed {
+                properties[artifactory.PropertyStatus] = "failed"
+            }
+            for dependency, status := range statuses(results) {
+                properties[artifactory.PropertyComponentPrefix+dependency] = status
+            }
+            err := jfrogClient.SetChartProperties(chart, properties)
+            if err != nil {
+                slog.Error("Publishing properties", "chart", chart.String(), "error", err)
+            } else {
+                slog.Debug("Published properties", "chart", chart.String())
+            }
+        }
+    }
+
+    // Promote only when every component passed, and keep a record of the decision either way
+    var promoteErr error
+    if *promoteFlag {
+        promoteErr = promote(jfrogClient, chart, failed, statuses(results))
+    }
+
+    // Clean up the working directory before proceeding
+    utils.CleanWorkingDirectory(config.CleaningPattern) 
+
+    if promoteErr != nil {
+        exitcode.Fatalf(exitcode.Unavailable, "Promotion failed: %v", promoteErr)
+    }
+    switch code := exitCode(failed, results); code {
+    case exitcode.Passed:
+        slog.Info("All components passed")
+    case exitcode.NotFound:
+        exitcode.Fatalf(code, "One or more components were not found in SonarQube")
+    case exitcode.Unavailable:
+        exitcode.Fatalf(code, "SonarQube could not be queried for one or more components")
+    default:
+        exitcode.Fatalf(code, "One or more components failed in SonarQube status check")
+    }
+}
+
+// newReport starts the report of a check with the coordinates of what is checked
+func newReport(chart artifactory.ChartRef, digest string, sonarServer *sonarqube.Server, started time.Time) *report.Report {
+    r := &report.Report{
+        Tool:      report.Tool{Name: "SonarCheck", Version: strings.TrimPrefix(version, "v")},
+        SonarQube: report.SonarQube{URL: sonarServer.URL, Version: sonarServer.Version},
+    }
+    r.Timings.Started = started
+    if config.DependencySource == config.SourceBuildInfo {
+        r.Build = &report.Build{Name: config.BuildName, Number: config.BuildNumber, File: config.BuildInfoFile}
+    } else {
+        r.Chart = &report.Chart{
+            Registry:   chart.Registry,
+            Repository: chart.Repository,
+            Name:       chart.Name,
+            Version:    chart.Version,
+            Digest:     digest,
+        }
+    }
+    return r
+}
+
+// failSeverity is the severity of a component that couldn't be checked, a warn only policy never fails the check
+func failSeverity(componentPolicy policy.Policy) string {
+    if componentPolicy.WarnOnly {
+        return policy.SeverityWarning
+    }
+    return policy.SeverityError
+}
+
+// writeReports writes every report that was asked for, a report that can't be written is logged but doesn't fail the check
+func writeReports(r *report.Report) {
+    reports := []struct {
+        format string
+        path   string
+        write  func(path string) error
+    }{
+        {"JSON", config.ReportJSON, r.WriteJSON},
+        {"JUnit", config.ReportJUnit, r.WriteJUnit},
+        {"SARIF", config.ReportSARIF, r.WriteSARIF},
+        {"Markdown", config.ReportMarkdown, r.WriteMarkdown},
+        {"HTML", config.ReportHTML, r.WriteHTML},
+    }
+    for _, output := range reports {
+        if output.path == "" {
+            continue
+        }
+        if err := output.write(output.path); err != nil {
+            slog.Error("Writing report", "format", output.format, "error", err)
+        } else {
+            slog.Debug("Report written", "format", output.format, "path", output.path)
+        }
+    }
+}
+
+// exitCode picks the exit code of a failed check from the components with the error severity:
+// upstream errors first, then failed gates, then missing projects
+func exitCode(failed bool, results []policy.ComponentResult) int {
+    if !failed {
+        return exitcode.Passed
+    }
+
+    code := exitcode.Passed
+    for _, result := range results {
+        if result.Severity != policy.SeverityError {
+            continue
+        }
+        switch result.Status {
+        case "Error":
+            return exitcode.Unavailable
+        case "NotFound":
+            if code == exitcode.Passed {
+                code = exitcode.NotFound
+            }
+        default:
+            code = exitcode.GateFailed
+        }
+    }
+    if code == exitcode.Passed {
+        code = exitcode.GateFailed
+    }
+    return code
+}
+
+// statuses maps every component onto its status, for the chart properties and the audit record
+func statuses(results []policy.ComponentResult) map[string]string {
+    statuses := make(map[string]string, len(results))
+    for _, result := range results {
+        // A component checked in several versions is published with its failing one
+        if _, ok := statuses[result.Component.Name]; ok && result.Severity != policy.SeverityError {
+            continue
+        }
+        statuses[result.Component.Name] = result.Status
+    }
+    return statuses
+}
+
+// checkPromotable makes sure the promotion knows exactly what to promote, it never falls back to the defaults
+func checkPromotable(chart artifactory.ChartRef) error {
+    if config.DependencySource == config.SourceBuildInfo {
+        if config.BuildName == "" || config.BuildNumber == "" {
+            return fmt.Errorf("-promote needs the build name and number, set BUILD_NAME and BUILD_NUMBER or use a build-info file that has them")
+        }
+        return nil
+    }
+    if chart.Name == "" || chart.Version == "" {
+        return fmt.Errorf("-promote needs CHART_NAME and CHART_VERSION")
+    }
+    return nil
+}
+
+// promote calls the build promotion API for the build-info source and copies the chart otherwise
+func promote(jfrogClient *artifactory.Client, chart artifactory.ChartRef, failed bool, results map[string]string) error {
+    promotion := artifactory.Promotion{
+        TargetRepo: config.PromoteTargetRepo,
+        Status:     config.PromoteStatus,
+        Comment:    config.PromoteComment,
+        DryRun:     config.PromoteDryRun,
+    }
+    record := artifactory.AuditRecord{
+        TargetRepo: promotion.TargetRepo,
+        Status:     promotion.Status,
+        Comment:    promotion.Comment,
+        DryRun:     promotion.DryRun,
+        Components: results,
+    }
+
+    usesBuild := config.DependencySource == config.SourceBuildInfo
+    if usesBuild {
+        record.Method = "build-promotion"
+        record.Source = fmt.Sprintf("%s/%s", config.BuildName, config.BuildNumber)
+    } else {
+        record.Method = "copy"
+        record.Source = chart.Path()
+    }
+
+    var err error
+    if failed {
+        record.Reason = "one or more components failed the SonarQube status check"
+        slog.Info("Not promoted", "source", record.Source, "reason", record.Reason)
+    } else {
+        if usesBuild {
+            err = jfrogClient.PromoteBuild(config.BuildName, config.BuildNumber, promotion)
+        } else {
+            err = jfrogClient.PromoteChart(chart, promotion)
+        }
+        if err != nil {
+            record.Reason = "promotion request failed"
+            record.Error = err.Error()
+        } else {
+            record.Promoted = !promotion.DryRun
+            record.Reason = "all components passed the SonarQube status check"
+            if promotion.DryRun {
+                slog.Info("Dry run, would be promoted", "source", record.Source, "targetRepo", promotion.TargetRepo)
+            } else {
+                slog.Info("Promoted", "source", record.Source, "targetRepo", promotion.TargetRepo)
+            }
+        }
+    }
+
+    if auditErr := artifactory.WriteAuditRecord(config.PromoteAuditFile, record); auditErr != nil {
+        slog.Error("Writing promotion audit record", "error", auditErr)
+    }
+    return err
+}
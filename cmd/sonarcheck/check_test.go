@@ -0,0 +1,92 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+
+    "sonarcheck/pkg/artifactory"
+    "sonarcheck/pkg/config"
+)
+
+func setupPromotion(t *testing.T) (*artifactory.Client, *[]string, string) {
+    var requests []string
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        requests = append(requests, r.Method+" "+r.URL.EscapedPath())
+        w.Write([]byte(`{}`))
+    }))
+    t.Cleanup(server.Close)
+    client := artifactory.NewClient(server.URL, nil)
+    client.Retries = 0
+
+    auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+    config.PromoteTargetRepo, config.PromoteStatus, config.PromoteDryRun, config.PromoteAuditFile = "prod-charts", "sonar-passed", false, auditFile
+    config.DependencySource, config.BuildName, config.BuildNumber = config.SourceBuildInfo, "team/app", "42"
+    return client, &requests, auditFile
+}
+
+func readAuditRecord(t *testing.T, auditFile string) artifactory.AuditRecord {
+    data, err := os.ReadFile(auditFile)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var record artifactory.AuditRecord
+    if err := json.Unmarshal(data, &record); err != nil {
+        t.Fatalf("audit record %s: %v", data, err)
+    }
+    return record
+}
+
+func TestPromoteOnlyWhenPassed(t *testing.T) {
+    client, requests, auditFile := setupPromotion(t)
+
+    if err := promote(client, artifactory.ChartRef{}, true, map[string]string{"app": "ERROR"}); err != nil {
+        t.Fatalf("promote: %v", err)
+    }
+    if len(*requests) != 0 {
+        t.Errorf("failed check sent %v, want no request", *requests)
+    }
+    if record := readAuditRecord(t, auditFile); record.Promoted || record.Method != "build-promotion" || record.Source != "team/app/42" {
+        t.Errorf("audit record = %+v, want a build promotion of team/app/42 that didn't happen", record)
+    }
+}
+
+func TestPromoteBuild(t *testing.T) {
+    client, requests, auditFile := setupPromotion(t)
+
+    if err := promote(client, artifactory.ChartRef{}, false, map[string]string{"app": "OK"}); err != nil {
+        t.Fatalf("promote: %v", err)
+    }
+    if want := "POST /artifactory/api/build/promote/team%2Fapp/42"; len(*requests) != 1 || (*requests)[0] != want {
+        t.Errorf("sent %v, want %s", *requests, want)
+    }
+    if record := readAuditRecord(t, auditFile); !record.Promoted {
+        t.Errorf("audit record = %+v, want promoted", record)
+    }
+}
+
+func TestCheckPromotable(t *testing.T) {
+    tests := []struct {
+        name        string
+        source      string
+        buildName   string
+        buildNumber string
+        chart       artifactory.ChartRef
+        wantErr     bool
+    }{
+        {"build", config.SourceBuildInfo, "team/app", "42", artifactory.ChartRef{}, false},
+        // A build-info file without name and number must not fall back to copying the default chart folder
+        {"build-info without coordinates", config.SourceBuildInfo, "", "", artifactory.ChartRef{Registry: "charts-registry", Repository: "lieferscheine"}, true},
+        {"chart", config.SourceChart, "", "", artifactory.ChartRef{Registry: "charts-registry", Repository: "team", Name: "sample", Version: "1.0.0"}, false},
+        {"chart without version", config.SourceChart, "", "", artifactory.ChartRef{Registry: "charts-registry", Repository: "team", Name: "sample"}, true},
+    }
+    for _, test := range tests {
+        config.DependencySource, config.BuildName, config.BuildNumber = test.source, test.buildName, test.buildNumber
+        if err := checkPromotable(test.chart); (err != nil) != test.wantErr {
+            t.Errorf("%s: checkPromotable = %v, want error %v", test.name, err, test.wantErr)
+        }
+    }
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+    "flag"
+    "fmt"
+    "os"
+    "strings"
+    "text/tabwriter"
+    "time"
+
+    "sonarcheck/pkg/config"
+    "sonarcheck/pkg/exitcode"
+    "sonarcheck/pkg/sonarqube"
+    "sonarcheck/pkg/utils"
+    "sonarcheck/pkg/waiver"
+)
+
+// List the discovered components and their versions, SonarQube isn't queried
+func runDeps(fs *flag.FlagSet, args []string) {
+    parseFlags(fs, args)
+    prepare(false)
+
+    jfrogClient, chart := newJfrogClient()
+    checkArtifactory(jfrogClient)
+    components, _ := discoverComponents(jfrogClient, chart)
+    defer utils.CleanWorkingDirectory(config.CleaningPattern)
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "COMPONENT\tVERSION\tVERSION SOURCE\tPATH")
+    for _, component := range components {
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", component.Name, component.Version, component.VersionSource, component.Path)
+    }
+    w.Flush()
+}
+
+// Show the SonarQube project key of every component
+func runResolve(fs *flag.FlagSet, args []string) {
+    parseFlags(fs, args)
+    prepare(true)
+
+    jfrogClient, chart := newJfrogClient()
+    sonarServer := connectSonarQube()
+    checkArtifactory(jfrogClient)
+    components, _ := discoverComponents(jfrogClient, chart)
+    defer utils.CleanWorkingDirectory(config.CleaningPattern)
+
+    w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+    fmt.Fprintln(w, "COMPONENT\tVERSION\tPROJECT KEY\tRESOLVED BY")
+    for _, component := range components {
+        projectKey, resolvedBy := resolveProjectKey(component.Name, sonarServer)
+        fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", component.Name, component.Version, projectKey, resolvedBy)
+    }
+    w.Flush()
+}
+
+// Explain how a component is found, classified and checked
+func runExplain(fs *flag.FlagSet, args []string) {
+    parseFlags(fs, args)
+    if fs.NArg() != 1 {
+        fs.Usage()
+        os.Exit(exitcode.ConfigError)
+    }
+    name := fs.Arg(0)
+    prepare(true)
+
+    jfrogClient, chart := newJfrogClient()
+    sonarServer := connectSonarQube()
+    checkArtifactory(jfrogClient)
+    components, _ := discoverComponents(jfrogClient, chart)
+    defer utils.CleanWorkingDirectory(config.CleaningPattern)
+
+    var component *utils.Component
+    for i := range components {
+        if components[i].Name == name {
+            component = &components[i]
+        }
+    }
+    if component == nil {
+        fmt.Printf("%s is not a component of %s\n", name, sourceDescription())
+        return
+    }
+
+    fmt.Printf("Component:      %s\n", component.Name)
+    fmt.Printf("Found in:       %s\n", component.Path)
+    if component.Repository != "" {
+        fmt.Printf("Repository:     %s\n", component.Repository)
+    }
+    version := component.Version
+    fmt.Printf("Version:        %q from %s (sources tried: %v)\n", component.Version, component.VersionSource, config.VersionSources)
+
+    override := config.FindOverride(name)
+    if override != nil {
+        fmt.Printf("Override:       pattern %q ignore=%t projectKey=%q version=%q\n", override.Pattern, override.Ignore, override.ProjectKey, override.Version)
+        if override.Version != "" {
+            version = override.Version
+        }
+    }
+
+    w, expired := waiver.Find(config.Waivers, name, version, time.Now())
+    for _, e := range expired {
+        fmt.Printf("Expired waiver: %q %s\n", e.Pattern, e)
+    }
+    match, _ := utils.CompareWithRegex(config.IgnoreRules, name)
+    switch {
+    case w != nil:
+        fmt.Printf("Classification: waived by %q, %s\n", w.Pattern, w)
+        return
+    case match || (override != nil && override.Ignore):
+        fmt.Printf("Classification: ignored (ignore rules: %q)\n", config.IgnoreRules)
+        return
+    case utils.IsLibraryChart(*component):
+        fmt.Printf("Classification: library chart, not checked\n")
+        return
+    case !utils.IsInternalComponent(*component, config.InternalOrigins):
+        fmt.Printf("Classification: external, not checked (internal origins: %v)\n", config.InternalOrigins)
+        return
+    }
+    fmt.Printf("Classification: internal, checked\n")
+    policy := config.FindPolicy(*component)
+    fmt.Printf("Policy:         %+v\n", policy)
+
+    if version == "" {
+        fmt.Printf("Status:         %s\n", utils.StatusNoVersion)
+        return
+    }
+    projectKey, resolvedBy := resolveProjectKey(name, sonarServer)
+    fmt.Printf("Project key:    %s (%s)\n", projectKey, resolvedBy)
+    if projectKey == "" {
+        return
+    }
+
+    analysis, err := sonarqube.SonarCheck(projectKey, version, policy.Branch, sonarServer)
+    if err != nil {
+        fmt.Printf("Status:         error: %v\n", err)
+        return
+    }
+    fmt.Printf("Analysis:       version %s from %s\n", analysis.Version, analysis.Date.Format(time.RFC3339))
+    fmt.Printf("Status:         %s\n", analysis.Status)
+    if violations := policy.Violations(version, analysis, time.Now()); len(violations) > 0 {
+        fmt.Printf("Violations:     %s\n", strings.Join(violations, ", "))
+    }
+}
+
+// resolveProjectKey returns the project key of a component and how it was found
+func resolveProjectKey(name string, sonarServer *sonarqube.Server) (string, string) {
+    if override := config.FindOverride(name); override != nil && override.ProjectKey != "" {
+        return override.ProjectKey, "config override"
+    }
+    projectKey, err := sonarqube.FindProjectKey(name, sonarServer)
+    if err != nil {
+        return "", "not found"
+    }
+    return projectKey, "component search"
+}
+
+func sourceDescription() string {
+    if config.DependencySource == config.SourceBuildInfo {
+        if config.BuildInfoFile != "" {
+            return config.BuildInfoFile
+        }
+        return fmt.Sprintf("build %s/%s", config.BuildName, config.BuildNumber)
+    }
+    return fmt.Sprintf("%s-%s", config.ChartName, config.ChartVersion)
+}
@@ -1,101 +1,225 @@
 package main
 
 import (
+    "errors"
     "flag"
-    "log"
+    "fmt"
+    "log/slog"
+    "os"
+    "strings"
 
     "sonarcheck/pkg/config"
+    "sonarcheck/pkg/exitcode"
+    "sonarcheck/pkg/httpclient"
+    "sonarcheck/pkg/logging"
     "sonarcheck/pkg/sonarqube"
     "sonarcheck/pkg/artifactory"
+    "sonarcheck/pkg/auth"
     "sonarcheck/pkg/utils"
 )
 
-func main() {
-    // Parse command-line flags
-    flag.BoolVar(&config.Verbose, "v", false, "enable verbose output")
-    flag.BoolVar(&config.Debug, "d", false, "enable debug output")
-    helpFlag := flag.Bool("h", false, "Show help")
-    flag.Parse()
+// version is set at build time with -ldflags "-X main.version=<version>"
+var version = "dev"
+
+type command struct {
+    name        string
+    args        string
+    description string
+    run         func(fs *flag.FlagSet, args []string)
+}
 
-    if *helpFlag {
+var commands = []command{
+    {"check", "[ignore rules]", "Check that every component passed the SonarQube quality gate (default command)", runCheck},
+    {"deps", "", "List the discovered components and their versions", runDeps},
+    {"resolve", "", "Show the SonarQube project key of every component", runResolve},
+    {"explain", "<component>", "Explain how a component is found, classified and checked", runExplain},
+    {"config", "", "Print the resolved config with secrets redacted", runConfig},
+    {"version", "", "Print the version of SonarCheck", runVersion},
+}
+
+func main() {
+    args := os.Args[1:]
+    if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
         utils.Help()
     }
 
-    // Load configurations
-    config.LoadEnv()
+    // Without a known subcommand the arguments belong to check, as in the first versions of the CLI
+    cmd := commands[0]
+    if len(args) > 0 {
+        for _, c := range commands {
+            if c.name == args[0] {
+                cmd = c
+                args = args[1:]
+                break
+            }
+        }
+    }
 
-    // Parse arguments
-    ignoreRules := flag.Arg(0)
+    fs := flag.NewFlagSet("SonarCheck "+cmd.name, flag.ContinueOnError)
+    fs.Usage = func() {
+        fmt.Fprintf(fs.Output(), "Usage: SonarCheck %s [OPTIONS] %s\n\n%s\n\nOptions:\n", cmd.name, cmd.args, cmd.description)
+        fs.PrintDefaults()
+    }
+    config.RegisterFlags(fs)
+    cmd.run(fs, args)
+}
 
-    // Check SonarQube and JFrog server availability
-    if err := sonarqube.CheckAvailability(config.SonarQubeURL, config.SonarQubeToken); err != nil {
-        log.Fatalf("[ERROR] %v", err)
+// parseFlags parses the command line and resolves the config, exiting on errors
+func parseFlags(fs *flag.FlagSet, args []string) {
+    if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+        os.Exit(exitcode.Passed)
+    } else if err != nil {
+        os.Exit(exitcode.ConfigError)
     }
-    if err := artifactory.CheckAvailability(config.JfrogURL); err != nil {
-        log.Fatalf("[ERROR] %v", err)
+
+    if err := config.Load(); err != nil {
+        exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+    }
+    if err := logging.Setup(config.LogLevel, config.LogFormat, os.Stderr); err != nil {
+        exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+    }
+}
+
+// prepare validates the config and sets up the shared transport, exiting on errors
+func prepare(requireSonarQube bool) {
+    if err := config.Validate(requireSonarQube); err != nil {
+        exitcode.Fatalf(exitcode.ConfigError, "%v", err)
     }
-    
-    // Fetch oci chart and extract the charts to find out subcharts and versions
-    artifactory.FetchOciChart(
-        config.JfrogURL, config.OCIRegistry, config.ChartRepository, 
-	config.ChartName, config.ChartVersion, config.JfrogCredentials, config.Verbose, config.Debug)
-    
-    // Extract appVersion from Chart.yaml in each layer's charts subdirectory
-    dependencies, err := utils.ExtractAppVersions(config.CleaningPattern)
+    // A malformed ignore rule would otherwise skip components silently
+    if _, err := utils.CompareWithRegex(config.IgnoreRules, ""); err != nil {
+        exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+    }
+
+    // Every request to SonarQube and Artifactory goes through the same transport
+    err := httpclient.Configure(httpclient.Settings{
+        CABundle:    config.TLSCABundle,
+        ClientCert:  config.TLSClientCert,
+        ClientKey:   config.TLSClientKey,
+        Insecure:    config.TLSInsecure,
+        Timeout:     config.HTTPTimeout,
+        TraceBodies: config.HTTPTraceBodies,
+        TraceHAR:    config.HTTPTraceHAR,
+        Version:     strings.TrimPrefix(version, "v"),
+    })
     if err != nil {
-            log.Printf("Error extracting appVersions: %v\n", err)
+        exitcode.Fatalf(exitcode.ConfigError, "TLS configuration: %v", err)
     }
+}
 
-    if config.Verbose || config.Debug {
-            log.Printf("[INFO] These dependencies found from buildInfo: %v\n", dependencies)
+// newJfrogClient builds the Artifactory client with credentials resolved per host
+func newJfrogClient() (*artifactory.Client, artifactory.ChartRef) {
+    dockerConfig := config.DockerConfig
+    if dockerConfig == "" {
+        dockerConfig = auth.DefaultDockerConfig()
+    }
+    credentials, err := auth.NewResolver(config.JfrogCredentials, config.JfrogHostCredentials, dockerConfig)
+    if err != nil {
+        exitcode.Fatalf(exitcode.ConfigError, "JFROG_CREDENTIALS: %v", err)
     }
 
-    // Check SonarQube status for each component
-    projectStatus := "ok"
-    for dependency, version := range dependencies {
-        // Check if there is an ignore rule for a dependency
-        match, err := utils.CompareWithRegex(ignoreRules, dependency)
-        if err != nil {
-            log.Printf("Error: %v\n", err)
-            continue
-        } else if match {
-            if config.Debug {
-                log.Printf("%s: Ignored", dependency)
-                log.Printf("Ignore rules: %s, dependency: %s", ignoreRules, dependency)
-            } else if config.Verbose {
-                log.Printf("%s: Ignored", dependency)
+    chart := artifactory.ChartRef{
+        Registry:   config.OCIRegistry,
+        Repository: config.ChartRepository,
+        Name:       config.ChartName,
+        Version:    config.ChartVersion,
+    }
+    return artifactory.NewClient(config.JfrogURL, credentials), chart
+}
+
+// Check SonarQube server availability and detect its version
+func connectSonarQube() *sonarqube.Server {
+    sonarServer, err := sonarqube.CheckAvailability(config.SonarQubeURL, config.SonarQubeToken, config.SonarQubeAuth)
+    if errors.Is(err, sonarqube.ErrUnreachable) {
+        exitcode.Fatalf(exitcode.Unavailable, "%v", err)
+    } else if err != nil {
+        exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+    }
+    slog.Info("SonarQube detected", "version", sonarServer.Version, "auth", sonarServer.AuthScheme)
+    return sonarServer
+}
+
+// Check JFrog server availability, the oci repository only matters for the chart source
+func checkArtifactory(jfrogClient *artifactory.Client) {
+    ociRegistry := config.OCIRegistry
+    if config.DependencySource != config.SourceChart {
+        ociRegistry = ""
+    }
+    if err := jfrogClient.CheckAvailability(ociRegistry, config.ChartRepository); errors.Is(err, artifactory.ErrUnreachable) {
+        exitcode.Fatalf(exitcode.Unavailable, "%v", err)
+    } else if err != nil {
+        exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+    }
+}
+
+// discoverComponents finds the components of the umbrella chart or the build, and the manifest digest of the chart.
+// For the chart source the extracted layers stay in the working directory until the caller cleans them up.
+func discoverComponents(jfrogClient *artifactory.Client, chart artifactory.ChartRef) ([]utils.Component, string) {
+    var components []utils.Component
+    var digest string
+    switch config.DependencySource {
+    case config.SourceBuildInfo:
+        // Read the dependencies from the build-info and resolve their versions by checksum
+        var buildInfo *artifactory.BuildInfo
+        var err error
+        if config.BuildInfoFile != "" {
+            buildInfo, err = artifactory.ReadBuildInfoFile(config.BuildInfoFile)
+            if err != nil {
+                exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+            }
+            // The exported build-info knows which build it is, the promotion and the report need that
+            if config.BuildName == "" && config.BuildNumber == "" {
+                config.BuildName, config.BuildNumber = buildInfo.Name, buildInfo.Number
+            }
+        } else {
+            buildInfo, err = jfrogClient.FetchBuildInfo(config.BuildName, config.BuildNumber)
+            if errors.Is(err, artifactory.ErrNotFound) {
+                exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+            } else if err != nil {
+                exitcode.Fatalf(exitcode.Unavailable, "%v", err)
             }
-            continue
         }
-  
-        // Find the project key for the dependency
-        projectKey, err := sonarqube.FindProjectKey(dependency, config.SonarQubeURL, config.SonarQubeToken)
+        components = jfrogClient.BuildInfoComponents(buildInfo)
+    default:
+        // Fetch oci chart and extract the charts to find out subcharts and versions
+        // Without every layer some components would silently be left unchecked
+        manifest, err := jfrogClient.FetchOciChart(chart)
         if err != nil {
-            log.Printf("%s: Not Found", dependency)
-            projectStatus = "notOK"
-            continue
+            utils.CleanWorkingDirectory(config.CleaningPattern)
+            if errors.Is(err, artifactory.ErrManifestNotFound) {
+                exitcode.Fatalf(exitcode.ConfigError, "%v", err)
+            }
+            exitcode.Fatalf(exitcode.Unavailable, "%v", err)
         }
 
-        // Check the SonarQube scan status of the dependency
-        status, err := sonarqube.SonarCheck(projectKey, version, config.SonarQubeURL, config.SonarQubeToken, config.Debug)
+        digest = manifest.Digest
+
+        // Extract appVersion from Chart.yaml in each layer's charts subdirectory
+        components, err = utils.ExtractComponents(config.CleaningPattern, config.VersionSources, config.VersionAnnotation)
         if err != nil {
-            log.Printf("[Error] sending GET request for dependency %s: %v", dependency, err)
-            projectStatus = "notOK"
-            continue
+            slog.Error("Extracting components", "chart", chart.String(), "error", err)
         }
-
-        // Print the status of SonarQube check
-        projectStatus = utils.LogStatus(dependency, version, status, projectStatus, config.Verbose, config.Debug)
     }
 
-    
-    // Clean up the working directory before proceeding
-    utils.CleanWorkingDirectory(config.CleaningPattern, config.Verbose, config.Debug) 
+    for _, component := range components {
+        logging.Component(component.Name, component.Version).Debug("Dependency found", "versionSource", component.VersionSource, "path", component.Path)
+    }
+    return components, digest
+}
 
-    if projectStatus == "notOK" {
-        log.Fatalf("[ERROR] One or more components failed in SonarQube status check.")
-    } else {
-        log.Printf("[INFO]: All components passed.")
+// Print the resolved config with secrets redacted
+func runConfig(fs *flag.FlagSet, args []string) {
+    parseFlags(fs, args)
+    if err := config.Print(os.Stdout); err != nil {
+        exitcode.Fatalf(exitcode.ConfigError, "%v", err)
     }
 }
 
+// Print the version of SonarCheck
+func runVersion(fs *flag.FlagSet, args []string) {
+    if err := fs.Parse(args); errors.Is(err, flag.ErrHelp) {
+        os.Exit(exitcode.Passed)
+    } else if err != nil {
+        os.Exit(exitcode.ConfigError)
+    }
+    fmt.Println("SonarCheck", strings.TrimPrefix(version, "v"))
+}
@@ -0,0 +1,162 @@
+package artifactory
+
+import (
+        "encoding/json"
+        "fmt"
+        "io/ioutil"
+        "net/url"
+        "strings"
+
+        "sonarcheck/pkg/logging"
+        "sonarcheck/pkg/utils"
+)
+
+// define checksum search response type
+type checksumSearchResponse struct {
+        Results []struct {
+                URI string `json:"uri"`
+        } `json:"results"`
+}
+
+// Find the version of an artifact by its sha256 through the checksum search
+func (c *Client) FindDependencyVersion(dependency, sha256 string) (string, error) {
+        body, err := c.Get("api/search/checksum?sha256=" + sha256)
+        if err != nil {
+                return "", err
+        }
+
+        var response checksumSearchResponse
+        if err := json.Unmarshal(body, &response); err != nil {
+                return "", fmt.Errorf("unmarshalling JSON response: %v", err)
+        }
+        // Check if the results array is empty
+        if len(response.Results) == 0 {
+                return "", fmt.Errorf("%w: no results for %s with sha256: %s", ErrNotFound, dependency, sha256)
+        }
+
+        // Extract the version from the URI
+        uri := response.Results[0].URI
+        parts := strings.Split(uri, "/")
+        if len(parts) < 2 {
+                return "", fmt.Errorf("unable to extract version from URI: %s", uri)
+        }
+
+        // Assuming the version is the second last part of the URI
+        version := parts[len(parts)-2]
+        return version, nil
+}
+
+// define build-info types, only the fields needed to find the dependencies
+type BuildInfo struct {
+        Name    string `json:"name"`
+        Number  string `json:"number"`
+        Modules []struct {
+                ID           string `json:"id"`
+                Dependencies []struct {
+                        ID     string `json:"id"`
+                        Type   string `json:"type"`
+                        Sha256 string `json:"sha256"`
+                } `json:"dependencies"`
+        } `json:"modules"`
+}
+
+// The REST API wraps the build-info in a "buildInfo" field, exported files don't
+type buildInfoResponse struct {
+        BuildInfo *BuildInfo `json:"buildInfo"`
+}
+
+// Get the build-info of a build from artifactory
+func (c *Client) FetchBuildInfo(buildName, buildNumber string) (*BuildInfo, error) {
+        // Build names often hold slashes, e.x. "team/app", which have to stay in the path segment
+        body, err := c.Get(fmt.Sprintf("api/build/%s/%s", url.PathEscape(buildName), url.PathEscape(buildNumber)))
+        if err != nil {
+                return nil, fmt.Errorf("fetching build-info %s/%s: %w", buildName, buildNumber, err)
+        }
+        return parseBuildInfo(body)
+}
+
+// Read a build-info exported as JSON, e.x. with "jf rt build-publish --dry-run"
+func ReadBuildInfoFile(path string) (*BuildInfo, error) {
+        body, err := ioutil.ReadFile(path)
+        if err != nil {
+                return nil, fmt.Errorf("reading build-info file: %v", err)
+        }
+        return parseBuildInfo(body)
+}
+
+func parseBuildInfo(body []byte) (*BuildInfo, error) {
+        var response buildInfoResponse
+        if err := json.Unmarshal(body, &response); err != nil {
+                return nil, fmt.Errorf("unmarshalling build-info: %v", err)
+        }
+        if response.BuildInfo != nil {
+                return response.BuildInfo, nil
+        }
+
+        var buildInfo BuildInfo
+        if err := json.Unmarshal(body, &buildInfo); err != nil {
+                return nil, fmt.Errorf("unmarshalling build-info: %v", err)
+        }
+        return &buildInfo, nil
+}
+
+// Turn the build-info dependencies into components, the version of each one is looked up by its sha256.
+// If the checksum search finds nothing, the version from the dependency id is used. A dependency found in
+// several versions is checked in each of them, with a warning.
+func (c *Client) BuildInfoComponents(buildInfo *BuildInfo) []utils.Component {
+        var components []utils.Component
+        lookedUp := make(map[string]bool) // dependency ids with their sha256, each one is looked up once
+        seen := make(map[string]bool)     // name:version of the components
+        versions := make(map[string]string)
+
+        for _, module := range buildInfo.Modules {
+                for _, dependency := range module.Dependencies {
+                        name, idVersion := splitDependencyID(dependency.ID)
+                        if name == "" || lookedUp[dependency.ID+"@"+dependency.Sha256] {
+                                continue
+                        }
+                        lookedUp[dependency.ID+"@"+dependency.Sha256] = true
+
+                        version, versionSource := idVersion, "build-info id"
+                        if dependency.Sha256 != "" {
+                                found, err := c.FindDependencyVersion(name, dependency.Sha256)
+                                if err == nil {
+                                        version, versionSource = found, "checksum"
+                                } else {
+                                        logging.Component(name, idVersion).Debug("Checksum search failed, using version from build-info", "error", err)
+                                }
+                        }
+
+                        if seen[name+":"+version] {
+                                continue
+                        }
+                        seen[name+":"+version] = true
+                        if other, ok := versions[name]; ok {
+                                logging.Component(name, version).Warn("Dependency found in several versions, checking each of them", "otherVersion", other, "module", module.ID)
+                        } else {
+                                versions[name] = version
+                        }
+
+                        components = append(components, utils.Component{
+                                Name:          name,
+                                Version:       version,
+                                VersionSource: versionSource,
+                                Path:          fmt.Sprintf("%s/%s#%s", buildInfo.Name, buildInfo.Number, module.ID),
+                        })
+                }
+        }
+        return components
+}
+
+// Dependency ids look like "name:version" or "group:name:version"
+func splitDependencyID(id string) (string, string) {
+        parts := strings.Split(id, ":")
+        switch len(parts) {
+        case 1:
+                return parts[0], ""
+        case 2:
+                return parts[0], parts[1]
+        default:
+                return parts[len(parts)-2], parts[len(parts)-1]
+        }
+}
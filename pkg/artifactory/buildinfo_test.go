@@ -0,0 +1,49 @@
+package artifactory
+
+import (
+        "net/http"
+        "net/http/httptest"
+        "reflect"
+        "testing"
+)
+
+func TestFetchBuildInfoEscapesNameAndNumber(t *testing.T) {
+        var path string
+        server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                path = r.URL.EscapedPath()
+                w.Write([]byte(`{"buildInfo":{"name":"team/app","number":"1 2","modules":[]}}`))
+        }))
+        defer server.Close()
+        client := NewClient(server.URL, nil)
+        client.Retries = 0
+
+        buildInfo, err := client.FetchBuildInfo("team/app", "1 2")
+        if err != nil {
+                t.Fatalf("FetchBuildInfo: %v", err)
+        }
+        if want := "/artifactory/api/build/team%2Fapp/1%202"; path != want {
+                t.Errorf("requested %s, want %s", path, want)
+        }
+        if buildInfo.Name != "team/app" {
+                t.Errorf("build name = %q, want team/app", buildInfo.Name)
+        }
+}
+
+func TestBuildInfoComponentsKeepsEveryVersion(t *testing.T) {
+        buildInfo, err := parseBuildInfo([]byte(`{"name":"umbrella","number":"7","modules":[
+                {"id":"backend","dependencies":[{"id":"app:1.0.0"},{"id":"lib:2.0.0"},{"id":"app:1.0.0"}]},
+                {"id":"frontend","dependencies":[{"id":"app:1.1.0"},{"id":"lib:2.0.0"}]}]}`))
+        if err != nil {
+                t.Fatal(err)
+        }
+        client := NewClient("http://artifactory.invalid", nil)
+
+        var got []string
+        for _, component := range client.BuildInfoComponents(buildInfo) {
+                got = append(got, component.Name+":"+component.Version+" "+component.Path)
+        }
+        want := []string{"app:1.0.0 umbrella/7#backend", "lib:2.0.0 umbrella/7#backend", "app:1.1.0 umbrella/7#frontend"}
+        if !reflect.DeepEqual(got, want) {
+                t.Errorf("BuildInfoComponents = %q, want %q", got, want)
+        }
+}
@@ -0,0 +1,197 @@
+package artifactory
+
+import (
+        "bytes"
+        "errors"
+        "fmt"
+        "io"
+        "io/ioutil"
+        "net/http"
+        "strings"
+        "time"
+
+        "sonarcheck/pkg/auth"
+        "sonarcheck/pkg/httpclient"
+)
+
+// Errors of the Artifactory API, a StatusError matches them through errors.Is
+var (
+        ErrUnreachable           = errors.New("JFrog server is not reachable")
+        ErrUnauthorized          = errors.New("JFrog credentials were rejected")
+        ErrForbidden             = errors.New("JFrog credentials are not allowed to do this")
+        ErrNotFound              = errors.New("not found in Artifactory")
+        ErrRepositoryNotFound    = errors.New("OCI repository not found")
+        ErrRepositoryNotReadable = errors.New("JFrog credentials cannot read the OCI repository")
+)
+
+// StatusError is returned when Artifactory answers with an unexpected status
+type StatusError struct {
+        Method     string
+        URL        string
+        StatusCode int
+        Status     string
+        Body       string
+}
+
+func (e *StatusError) Error() string {
+        if e.Body != "" {
+                return fmt.Sprintf("%s %s: %s %s", e.Method, e.URL, e.Status, e.Body)
+        }
+        return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// Is maps the status code onto the generic errors, e.x. errors.Is(err, ErrNotFound)
+func (e *StatusError) Is(target error) bool {
+        switch target {
+        case ErrUnauthorized:
+                return e.StatusCode == http.StatusUnauthorized
+        case ErrForbidden:
+                return e.StatusCode == http.StatusForbidden
+        case ErrNotFound:
+                return e.StatusCode == http.StatusNotFound
+        }
+        return false
+}
+
+// ChartRef points at an umbrella chart inside an oci registry in Artifactory
+type ChartRef struct {
+        Registry   string
+        Repository string
+        Name       string
+        Version    string
+}
+
+// Path of the chart folder inside Artifactory, e.x. charts-registry/team/app/1.0.0
+func (r ChartRef) Path() string {
+        return fmt.Sprintf("%s/%s/%s/%s", r.Registry, r.Repository, r.Name, r.Version)
+}
+
+func (r ChartRef) String() string {
+        return fmt.Sprintf("%s-%s", r.Name, r.Version)
+}
+
+// Client talks to one Artifactory instance, every operation on Artifactory goes through it
+type Client struct {
+        BaseURL     string
+        Credentials *auth.Resolver
+        Retries     int
+        RetryWait   time.Duration
+}
+
+// NewClient returns a client for the JFrog URL, with or without a trailing slash
+func NewClient(jfrogURL string, credentials *auth.Resolver) *Client {
+        return &Client{
+                BaseURL:     strings.TrimSuffix(jfrogURL, "/"),
+                Credentials: credentials,
+                Retries:     2,
+                RetryWait:   time.Second,
+        }
+}
+
+// URL joins the path onto "<JFROG_URL>/artifactory/"
+func (c *Client) URL(path string) string {
+        return c.BaseURL + "/artifactory/" + strings.TrimPrefix(path, "/")
+}
+
+// Do sends a request with the credentials of the host. Connection errors, 429 and 5xx answers are retried
+// for idempotent methods. Any status other than 2xx is returned as a *StatusError, the caller closes the body.
+func (c *Client) Do(method, path string, body []byte, header http.Header) (*http.Response, error) {
+        requestURL := c.URL(path)
+        retries := c.Retries
+        if method == "POST" {
+                retries = 0
+        }
+
+        var lastErr error
+        for attempt := 0; attempt <= retries; attempt++ {
+                if attempt > 0 {
+                        time.Sleep(c.RetryWait * time.Duration(attempt))
+                }
+
+                var reader io.Reader
+                if body != nil {
+                        reader = bytes.NewReader(body)
+                }
+                req, err := http.NewRequest(method, requestURL, reader)
+                if err != nil {
+                        return nil, fmt.Errorf("creating %s request: %v", method, err)
+                }
+                for key, values := range header {
+                        req.Header[key] = values
+                }
+                if c.Credentials != nil {
+                        c.Credentials.Apply(req)
+                }
+
+                resp, err := httpclient.Client().Do(req)
+                if err != nil {
+                        lastErr = fmt.Errorf("%w: %s %s: %v", ErrUnreachable, method, requestURL, err)
+                        continue
+                }
+                if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+                        return resp, nil
+                }
+
+                data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+                resp.Body.Close()
+                lastErr = &StatusError{
+                        Method:     method,
+                        URL:        requestURL,
+                        StatusCode: resp.StatusCode,
+                        Status:     resp.Status,
+                        Body:       strings.TrimSpace(string(data)),
+                }
+                if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+                        break
+                }
+        }
+        return nil, lastErr
+}
+
+// Get sends a GET request and returns the whole body
+func (c *Client) Get(path string) ([]byte, error) {
+        resp, err := c.Do("GET", path, nil, nil)
+        if err != nil {
+                return nil, err
+        }
+        defer resp.Body.Close()
+
+        body, err := ioutil.ReadAll(resp.Body)
+        if err != nil {
+                return nil, fmt.Errorf("reading response body: %v", err)
+        }
+        return body, nil
+}
+
+// Check availability of jfrog artifactory through api/system/ping, then make sure the credentials
+// can read the oci repository. The repository check is skipped when the registry is empty.
+func (c *Client) CheckAvailability(ociRegistry, chartRepository string) error {
+        if _, err := c.Get("api/system/ping"); err != nil {
+                if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrForbidden) {
+                        return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+                }
+                if errors.Is(err, ErrUnreachable) {
+                        return fmt.Errorf("%w", err)
+                }
+                return fmt.Errorf("%w: %v", ErrUnreachable, err)
+        }
+
+        if ociRegistry == "" {
+                return nil
+        }
+        _, err := c.Get(fmt.Sprintf("api/storage/%s/%s", ociRegistry, chartRepository))
+        switch {
+        case err == nil:
+                return nil
+        case errors.Is(err, ErrUnauthorized):
+                return fmt.Errorf("%w: %v", ErrUnauthorized, err)
+        case errors.Is(err, ErrForbidden):
+                return fmt.Errorf("%w: %v", ErrRepositoryNotReadable, err)
+        case errors.Is(err, ErrNotFound):
+                return fmt.Errorf("%w: %v", ErrRepositoryNotFound, err)
+        case errors.Is(err, ErrUnreachable):
+                return fmt.Errorf("%w", err)
+        default:
+                return fmt.Errorf("%w: %v", ErrUnreachable, err)
+        }
+}
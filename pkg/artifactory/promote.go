@@ -0,0 +1,110 @@
+package artifactory
+
+import (
+        "encoding/json"
+        "fmt"
+        "net/http"
+        "net/url"
+        "os"
+        "time"
+)
+
+// Promotion settings, the target repository is the only required one
+type Promotion struct {
+        TargetRepo string
+        Status     string
+        Comment    string
+        DryRun     bool
+}
+
+// AuditRecord describes one promotion decision, written as a JSON line to the audit file
+type AuditRecord struct {
+        Timestamp  string            `json:"timestamp"`
+        Method     string            `json:"method"`
+        Source     string            `json:"source"`
+        TargetRepo string            `json:"targetRepo"`
+        Status     string            `json:"status,omitempty"`
+        Comment    string            `json:"comment,omitempty"`
+        DryRun     bool              `json:"dryRun"`
+        Promoted   bool              `json:"promoted"`
+        Reason     string            `json:"reason"`
+        Components map[string]string `json:"components"`
+        Error      string            `json:"error,omitempty"`
+}
+
+type buildPromotionRequest struct {
+        Status     string `json:"status,omitempty"`
+        Comment    string `json:"comment,omitempty"`
+        TargetRepo string `json:"targetRepo"`
+        DryRun     bool   `json:"dryRun"`
+        Copy       bool   `json:"copy"`
+}
+
+// Promote a build through the build promotion API
+func (c *Client) PromoteBuild(buildName, buildNumber string, promotion Promotion) error {
+        if buildName == "" || buildNumber == "" {
+                return fmt.Errorf("promoting build %s/%s: build name and number are required", buildName, buildNumber)
+        }
+        payload, err := json.Marshal(buildPromotionRequest{
+                Status:     promotion.Status,
+                Comment:    promotion.Comment,
+                TargetRepo: promotion.TargetRepo,
+                DryRun:     promotion.DryRun,
+                Copy:       true,
+        })
+        if err != nil {
+                return fmt.Errorf("marshalling promotion request: %v", err)
+        }
+
+        header := http.Header{"Content-Type": []string{"application/json"}}
+        path := fmt.Sprintf("api/build/promote/%s/%s", url.PathEscape(buildName), url.PathEscape(buildNumber))
+        resp, err := c.Do("POST", path, payload, header)
+        if err != nil {
+                return fmt.Errorf("promoting build %s/%s: %w", buildName, buildNumber, err)
+        }
+        resp.Body.Close()
+        return nil
+}
+
+// Promote the umbrella chart by copying its folder into the target repository. Without a chart name and
+// version the folder would be the whole repository, so those are required.
+func (c *Client) PromoteChart(chart ChartRef, promotion Promotion) error {
+        if chart.Name == "" || chart.Version == "" {
+                return fmt.Errorf("promoting chart %s: chart name and version are required", chart)
+        }
+        chartPath := fmt.Sprintf("%s/%s/%s", chart.Repository, chart.Name, chart.Version)
+        path := fmt.Sprintf("api/copy/%s/%s?to=%s", chart.Registry, chartPath, url.QueryEscape("/"+promotion.TargetRepo+"/"+chartPath))
+        if promotion.DryRun {
+                path += "&dry=1"
+        }
+
+        resp, err := c.Do("POST", path, nil, nil)
+        if err != nil {
+                return fmt.Errorf("promoting chart %s: %w", chart, err)
+        }
+        resp.Body.Close()
+        return nil
+}
+
+// Append the audit record to the audit file, one JSON object per line
+func WriteAuditRecord(auditFile string, record AuditRecord) error {
+        if record.Timestamp == "" {
+                record.Timestamp = time.Now().UTC().Format(time.RFC3339)
+        }
+
+        line, err := json.Marshal(record)
+        if err != nil {
+                return fmt.Errorf("marshalling audit record: %v", err)
+        }
+
+        file, err := os.OpenFile(auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+        if err != nil {
+                return fmt.Errorf("opening audit file: %v", err)
+        }
+        defer file.Close()
+
+        if _, err := file.Write(append(line, '\n')); err != nil {
+                return fmt.Errorf("writing audit file: %v", err)
+        }
+        return nil
+}
@@ -0,0 +1,138 @@
+package artifactory
+
+import (
+        "encoding/json"
+        "io"
+        "net/http"
+        "net/http/httptest"
+        "os"
+        "path/filepath"
+        "reflect"
+        "strings"
+        "testing"
+)
+
+// promotionServer stands in for the build promotion and copy APIs and records the last request
+type promotionServer struct {
+        requests int
+        method   string
+        path     string
+        query    string
+        body     []byte
+}
+
+func (s *promotionServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+        s.requests++
+        s.method, s.path, s.query = r.Method, r.URL.EscapedPath(), r.URL.RawQuery
+        s.body, _ = io.ReadAll(r.Body)
+        w.Write([]byte(`{"messages":[]}`))
+}
+
+func newPromotionServer(t *testing.T) (*promotionServer, *Client) {
+        stub := &promotionServer{}
+        server := httptest.NewServer(stub)
+        t.Cleanup(server.Close)
+        client := NewClient(server.URL, nil)
+        client.Retries = 0
+        return stub, client
+}
+
+func TestPromoteBuild(t *testing.T) {
+        for _, dryRun := range []bool{false, true} {
+                stub, client := newPromotionServer(t)
+                promotion := Promotion{TargetRepo: "prod-charts", Status: "sonar-passed", Comment: "gate passed", DryRun: dryRun}
+                if err := client.PromoteBuild("team/app", "42", promotion); err != nil {
+                        t.Fatalf("PromoteBuild: %v", err)
+                }
+
+                if want := "/artifactory/api/build/promote/team%2Fapp/42"; stub.method != "POST" || stub.path != want {
+                        t.Errorf("sent %s %s, want POST %s", stub.method, stub.path, want)
+                }
+                var got buildPromotionRequest
+                if err := json.Unmarshal(stub.body, &got); err != nil {
+                        t.Fatalf("promotion request %s: %v", stub.body, err)
+                }
+                want := buildPromotionRequest{Status: "sonar-passed", Comment: "gate passed", TargetRepo: "prod-charts", DryRun: dryRun, Copy: true}
+                if got != want {
+                        t.Errorf("promotion request = %+v, want %+v", got, want)
+                }
+        }
+}
+
+func TestPromoteChart(t *testing.T) {
+        chart := ChartRef{Registry: "charts-registry", Repository: "team", Name: "sample", Version: "1.0.0"}
+        tests := []struct {
+                dryRun    bool
+                wantQuery string
+        }{
+                {false, "to=%2Fprod-charts%2Fteam%2Fsample%2F1.0.0"},
+                {true, "to=%2Fprod-charts%2Fteam%2Fsample%2F1.0.0&dry=1"},
+        }
+        for _, test := range tests {
+                stub, client := newPromotionServer(t)
+                if err := client.PromoteChart(chart, Promotion{TargetRepo: "prod-charts", DryRun: test.dryRun}); err != nil {
+                        t.Fatalf("PromoteChart: %v", err)
+                }
+                if want := "/artifactory/api/copy/charts-registry/team/sample/1.0.0"; stub.method != "POST" || stub.path != want {
+                        t.Errorf("sent %s %s, want POST %s", stub.method, stub.path, want)
+                }
+                if stub.query != test.wantQuery {
+                        t.Errorf("query = %s, want %s", stub.query, test.wantQuery)
+                }
+        }
+}
+
+func TestPromoteWithoutCoordinates(t *testing.T) {
+        stub, client := newPromotionServer(t)
+        promotion := Promotion{TargetRepo: "prod-charts"}
+
+        if err := client.PromoteChart(ChartRef{Registry: "charts-registry", Repository: "team"}, promotion); err == nil {
+                t.Errorf("PromoteChart without name and version: expected an error")
+        }
+        if err := client.PromoteBuild("", "", promotion); err == nil {
+                t.Errorf("PromoteBuild without name and number: expected an error")
+        }
+        if stub.requests != 0 {
+                t.Errorf("sent %d requests, want none", stub.requests)
+        }
+}
+
+func TestWriteAuditRecord(t *testing.T) {
+        auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+        records := []AuditRecord{
+                {Timestamp: "2026-10-18T12:00:00Z", Method: "copy", Source: "team/sample/1.0.0", TargetRepo: "prod-charts",
+                        Reason: "one or more components failed the SonarQube status check", Components: map[string]string{"app": "ERROR"}},
+                {Method: "build-promotion", Source: "team/app/42", TargetRepo: "prod-charts", Promoted: true,
+                        Reason: "all components passed the SonarQube status check", Components: map[string]string{"app": "OK"}},
+        }
+        for _, record := range records {
+                if err := WriteAuditRecord(auditFile, record); err != nil {
+                        t.Fatalf("WriteAuditRecord: %v", err)
+                }
+        }
+
+        data, err := os.ReadFile(auditFile)
+        if err != nil {
+                t.Fatal(err)
+        }
+        lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+        if len(lines) != len(records) {
+                t.Fatalf("audit file has %d lines, want %d:\n%s", len(lines), len(records), data)
+        }
+        if want := `{"timestamp":"2026-10-18T12:00:00Z","method":"copy","source":"team/sample/1.0.0","targetRepo":"prod-charts",` +
+                `"dryRun":false,"promoted":false,"reason":"one or more components failed the SonarQube status check","components":{"app":"ERROR"}}`; lines[0] != want {
+                t.Errorf("audit record\n%s\nwant\n%s", lines[0], want)
+        }
+
+        var second AuditRecord
+        if err := json.Unmarshal([]byte(lines[1]), &second); err != nil {
+                t.Fatal(err)
+        }
+        if second.Timestamp == "" {
+                t.Errorf("audit record without timestamp: %s", lines[1])
+        }
+        second.Timestamp = ""
+        if !reflect.DeepEqual(second, records[1]) {
+                t.Errorf("audit record = %+v, want %+v", second, records[1])
+        }
+}
@@ -0,0 +1,89 @@
+package artifactory
+
+import (
+        "encoding/json"
+        "errors"
+        "fmt"
+        "net/url"
+        "sort"
+        "strings"
+)
+
+// Property keys written onto the umbrella chart manifest after a check
+const (
+        PropertyStatus          = "sonarcheck.status"
+        PropertyTimestamp       = "sonarcheck.timestamp"
+        PropertyComponentPrefix = "sonarcheck.component."
+)
+
+// ErrGateNotPassed is returned by VerifyChartProperties when the chart wasn't checked or didn't pass
+var ErrGateNotPassed = errors.New("quality gate not passed")
+
+type propertiesResponse struct {
+        Properties map[string][]string `json:"properties"`
+}
+
+// Set properties on the umbrella chart manifest through the set-properties API
+func (c *Client) SetChartProperties(chart ChartRef, properties map[string]string) error {
+        // Properties are sent as "key=value|key=value", keys are sorted to keep the request stable
+        keys := make([]string, 0, len(properties))
+        for key := range properties {
+                keys = append(keys, key)
+        }
+        sort.Strings(keys)
+        pairs := make([]string, 0, len(keys))
+        for _, key := range keys {
+                pairs = append(pairs, escapeProperty(key)+"="+escapeProperty(properties[key]))
+        }
+
+        path := fmt.Sprintf("api/storage/%s/manifest.json?properties=%s&recursive=0",
+                chart.Path(), url.QueryEscape(strings.Join(pairs, "|")))
+        resp, err := c.Do("PUT", path, nil, nil)
+        if err != nil {
+                return fmt.Errorf("setting properties on %s: %w", chart, err)
+        }
+        resp.Body.Close()
+        return nil
+}
+
+// Read the properties back from the umbrella chart manifest
+func (c *Client) GetChartProperties(chart ChartRef) (map[string][]string, error) {
+        body, err := c.Get(fmt.Sprintf("api/storage/%s/manifest.json?properties", chart.Path()))
+        // Artifactory answers 404 when the item exists but has no properties
+        if errors.Is(err, ErrNotFound) {
+                return map[string][]string{}, nil
+        }
+        if err != nil {
+                return nil, fmt.Errorf("reading properties of %s: %w", chart, err)
+        }
+
+        var response propertiesResponse
+        if err := json.Unmarshal(body, &response); err != nil {
+                return nil, fmt.Errorf("unmarshalling properties: %v", err)
+        }
+        return response.Properties, nil
+}
+
+// Verify the properties written by a previous check say the chart passed
+func (c *Client) VerifyChartProperties(chart ChartRef) (map[string][]string, error) {
+        properties, err := c.GetChartProperties(chart)
+        if err != nil {
+                return nil, err
+        }
+
+        status := properties[PropertyStatus]
+        if len(status) == 0 {
+                return properties, fmt.Errorf("%w: %s has no %s property, it was never checked", ErrGateNotPassed, chart, PropertyStatus)
+        }
+        if status[0] != "passed" {
+                return properties, fmt.Errorf("%w: %s has %s=%s", ErrGateNotPassed, chart, PropertyStatus, status[0])
+        }
+        return properties, nil
+}
+
+// Artifactory separates properties with "|", key and value with "=" and the values of a key with ",",
+// so these are escaped with a backslash
+func escapeProperty(value string) string {
+        replacer := strings.NewReplacer(`\`, `\\`, ",", `\,`, "|", `\|`, "=", `\=`)
+        return replacer.Replace(value)
+}
@@ -0,0 +1,155 @@
+package artifactory
+
+import (
+        "encoding/json"
+        "errors"
+        "net/http"
+        "net/http/httptest"
+        "reflect"
+        "strings"
+        "testing"
+)
+
+// propertyServer stands in for the storage API of Artifactory: PUT ...?properties=k=v|k=v sets, GET ...?properties reads
+type propertyServer struct {
+        properties map[string][]string
+        raw        string
+}
+
+func (s *propertyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+        if !strings.HasSuffix(r.URL.Path, "/manifest.json") {
+                http.NotFound(w, r)
+                return
+        }
+        switch r.Method {
+        case "PUT":
+                s.raw = r.URL.Query().Get("properties")
+                for _, property := range splitEscaped(s.raw, '|') {
+                        pair := splitEscaped(property, '=')
+                        if len(pair) != 2 {
+                                http.Error(w, "malformed property "+property, http.StatusBadRequest)
+                                return
+                        }
+                        var values []string
+                        for _, value := range splitEscaped(pair[1], ',') {
+                                values = append(values, unescape(value))
+                        }
+                        s.properties[unescape(pair[0])] = values
+                }
+                w.WriteHeader(http.StatusNoContent)
+        case "GET":
+                if len(s.properties) == 0 {
+                        http.NotFound(w, r)
+                        return
+                }
+                json.NewEncoder(w).Encode(propertiesResponse{Properties: s.properties})
+        }
+}
+
+// splitEscaped splits on the separator unless it follows a backslash, the escapes stay in the parts
+func splitEscaped(value string, separator byte) []string {
+        var parts []string
+        start := 0
+        for i := 0; i < len(value); i++ {
+                switch value[i] {
+                case '\\':
+                        i++
+                case separator:
+                        parts = append(parts, value[start:i])
+                        start = i + 1
+                }
+        }
+        return append(parts, value[start:])
+}
+
+func unescape(value string) string {
+        var b strings.Builder
+        for i := 0; i < len(value); i++ {
+                if value[i] == '\\' && i+1 < len(value) {
+                        i++
+                }
+                b.WriteByte(value[i])
+        }
+        return b.String()
+}
+
+func newPropertyServer(t *testing.T) (*propertyServer, *Client, ChartRef) {
+        stub := &propertyServer{properties: make(map[string][]string)}
+        server := httptest.NewServer(stub)
+        t.Cleanup(server.Close)
+        client := NewClient(server.URL, nil)
+        client.Retries = 0
+        return stub, client, ChartRef{Registry: "charts-registry", Repository: "team", Name: "sample", Version: "1.0.0"}
+}
+
+func TestSetAndGetChartProperties(t *testing.T) {
+        stub, client, chart := newPropertyServer(t)
+
+        properties := map[string]string{
+                PropertyStatus:                  "passed",
+                PropertyTimestamp:               "2026-10-18T12:00:00Z",
+                PropertyComponentPrefix + "app": "OK",
+                PropertyComponentPrefix + "odd": `ERROR,a=b|c\d`,
+        }
+        if err := client.SetChartProperties(chart, properties); err != nil {
+                t.Fatalf("SetChartProperties: %v", err)
+        }
+        if want := 4; len(splitEscaped(stub.raw, '|')) != want {
+                t.Fatalf("sent %q, want %d properties separated by |", stub.raw, want)
+        }
+
+        got, err := client.GetChartProperties(chart)
+        if err != nil {
+                t.Fatalf("GetChartProperties: %v", err)
+        }
+        want := map[string][]string{}
+        for key, value := range properties {
+                want[key] = []string{value}
+        }
+        if !reflect.DeepEqual(got, want) {
+                t.Errorf("GetChartProperties = %v, want %v", got, want)
+        }
+}
+
+func TestGetChartPropertiesWithoutProperties(t *testing.T) {
+        _, client, chart := newPropertyServer(t)
+
+        got, err := client.GetChartProperties(chart)
+        if err != nil {
+                t.Fatalf("GetChartProperties: %v", err)
+        }
+        if len(got) != 0 {
+                t.Errorf("GetChartProperties = %v, want no properties", got)
+        }
+}
+
+func TestVerifyChartProperties(t *testing.T) {
+        tests := []struct {
+                name    string
+                status  string
+                wantErr error
+        }{
+                {"passed", "passed", nil},
+                {"failed", "failed", ErrGateNotPassed},
+                {"never checked", "", ErrGateNotPassed},
+        }
+        for _, test := range tests {
+                t.Run(test.name, func(t *testing.T) {
+                        _, client, chart := newPropertyServer(t)
+                        if test.status != "" {
+                                properties := map[string]string{PropertyStatus: test.status, PropertyTimestamp: "2026-10-18T12:00:00Z"}
+                                if err := client.SetChartProperties(chart, properties); err != nil {
+                                        t.Fatalf("SetChartProperties: %v", err)
+                                }
+                        }
+
+                        _, err := client.VerifyChartProperties(chart)
+                        if test.wantErr == nil && err != nil {
+                                t.Errorf("VerifyChartProperties: %v", err)
+                        }
+                        if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+                                t.Errorf("VerifyChartProperties = %v, want %v", err, test.wantErr)
+                        }
+                })
+        }
+}
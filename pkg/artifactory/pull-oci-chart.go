@@ -1,10 +1,11 @@
 package artifactory 
 
 import (
-	"log"
+	"log/slog"
+	"errors"
 	"fmt"
-        "net/http"
 	"encoding/json"
+	"crypto/sha256"
         "strings"
         "os"
 	"io"
@@ -12,8 +13,15 @@ import (
 	"sonarcheck/pkg/utils"
 )
 
+// Errors of FetchOciChart, wrapping the *StatusError with the URL and status of the failing call
+var (
+        ErrManifestNotFound = errors.New("chart manifest not found")
+        ErrLayerDownload    = errors.New("failed to download chart layer")
+)
+
 type Manifest struct {
-        SchemaVersion int `json:"schemaVersion"`
+        Digest        string `json:"-"`
+        SchemaVersion int    `json:"schemaVersion"`
         Config        struct {
                 MediaType string `json:"mediaType"`
                 Digest    string `json:"digest"`
@@ -26,112 +34,78 @@ type Manifest struct {
         } `json:"layers"`
 }
 
-// Check availability of jfrog artifactory
-func CheckAvailability(jfrogURL string) error {
-    resp, err := http.Get(jfrogURL)
-    if err != nil {
-        return fmt.Errorf("[ERROR] JFrog server is not reachable: %v", err)
-    }
-    defer resp.Body.Close()
-    if resp.StatusCode != http.StatusOK {
-        return fmt.Errorf("[ERROR] JFrog server returned non-OK status: %d", resp.StatusCode)
-    }
-    return nil
-}
-
-// Get oci helm chart from artifactory
-func FetchOciChart(jfrogURL, ociRegistry, chartRepository, chartName, chartVersion, jfrogCredentials string, verbose, debug bool) {
-	jfrogCredentialsParts := strings.SplitN(jfrogCredentials, ":", 2)
-
-        // artifactory credentials
-        user := jfrogCredentialsParts[0]
-        password := jfrogCredentialsParts[1]
-
-        // Construct the manifest URL
-        manifestURL := fmt.Sprintf("%s/artifactory/%s/%s/%s/%s/manifest.json", jfrogURL, ociRegistry, chartRepository, chartName, chartVersion)
-
-        // Make the HTTP GET request to fetch the manifest
-        req, err := http.NewRequest("GET", manifestURL, nil)
+// Get the oci manifest of the chart
+func (c *Client) FetchManifest(chart ChartRef) (*Manifest, error) {
+        body, err := c.Get(chart.Path() + "/manifest.json")
         if err != nil {
-                log.Fatalf("Error creating request:", err)
-                return
+                return nil, err
+        }
+
+        var manifest Manifest
+        if err := json.Unmarshal(body, &manifest); err != nil {
+                return nil, fmt.Errorf("decoding manifest of %s: %v", chart, err)
         }
-        req.SetBasicAuth(user, password)
+        // The digest of an oci manifest is the hash of its bytes
+        manifest.Digest = fmt.Sprintf("sha256:%x", sha256.Sum256(body))
+        return &manifest, nil
+}
 
-        client := &http.Client{}
-        resp, err := client.Do(req)
+// Download a blob of the chart, e.x. a layer, into the writer
+func (c *Client) FetchBlob(chart ChartRef, digest string, w io.Writer) error {
+        sha256Digest := strings.TrimPrefix(digest, "sha256:")
+        resp, err := c.Do("GET", fmt.Sprintf("%s/sha256__%s", chart.Path(), sha256Digest), nil, nil)
         if err != nil {
-                log.Fatalf("Error making request:", err)
-                return
+                return err
         }
         defer resp.Body.Close()
 
-        // Check if request was successful
-        if resp.StatusCode != http.StatusOK {
-                log.Fatalf("Error: failed to fetch manifest:", resp.Status)
-                return
-        }
+        _, err = io.Copy(w, resp.Body)
+        return err
+}
 
-        // Parse the JSON response
-        var manifest Manifest
-        err = json.NewDecoder(resp.Body).Decode(&manifest)
+// Get oci helm chart from artifactory and extract every layer into "layer_<n>", returns the manifest.
+// A failed layer doesn't stop the others, all layer errors are returned together.
+func (c *Client) FetchOciChart(chart ChartRef) (*Manifest, error) {
+        manifest, err := c.FetchManifest(chart)
+        if errors.Is(err, ErrNotFound) {
+                return nil, fmt.Errorf("%w: %s: %w", ErrManifestNotFound, chart, err)
+        }
         if err != nil {
-                log.Fatalf("Error decoding JSON:", err)
-                return
+                return nil, fmt.Errorf("fetching manifest of %s: %w", chart, err)
         }
 
         // By having the manifest we are able to download the layers of the chart
+        var layerErrors []error
         for i, layer := range manifest.Layers {
-                sha256Digest := strings.TrimPrefix(layer.Digest, "sha256:")
-                contentURL := fmt.Sprintf("%s/artifactory/%s/%s/%s/%s/sha256__%s", 
-		jfrogURL, ociRegistry, chartRepository, chartName, chartVersion, sha256Digest)
-
-                // Make the HTTP GET request to download the content
-                req, err = http.NewRequest("GET", contentURL, nil)
-                if err != nil {
-                        log.Fatalf("Error creating request:", err)
-                        return
-                }
-                req.SetBasicAuth(user, password)
-
-                resp, err = client.Do(req)
-                if err != nil {
-                        log.Fatalf("Error making request:", err)
-                        return
-                }
-                defer resp.Body.Close()
-                // Check if request was successful
-                if resp.StatusCode != http.StatusOK {
-                        log.Printf("[Error]: failed to download content for layer %d: %s\n", i+1, resp.Status)
-                        continue
-                }
-
-                // Create the output file with a unique name
                 filename := fmt.Sprintf("layer_%d.tgz", i+1)
-                outFile, err := os.Create(filename)
-                if err != nil {
-                        log.Fatalf("Error creating file:", err)
-                        return
-                }
-
-                // Write the response body to the file
-                _, err = io.Copy(outFile, resp.Body)
-                outFile.Close() // Close the file after writing
-                if err != nil {
-                        log.Fatalf("Error writing file:", err)
-                        return
+                if err := c.fetchLayer(chart, layer.Digest, filename); err != nil {
+                        if errors.Is(err, ErrUnauthorized) {
+                                return manifest, fmt.Errorf("%w: layer %d of %s: %w", ErrLayerDownload, i+1, chart, err)
+                        }
+                        layerErrors = append(layerErrors, fmt.Errorf("%w: layer %d of %s: %w", ErrLayerDownload, i+1, chart, err))
+                        continue
                 }
 
-		if verbose || debug {
-                      log.Printf("File %s downloaded successfully.\n", filename)
-                }
+                slog.Debug("Layer downloaded", "chart", chart.String(), "file", filename)
 
                 // Extract the .tgz chart
                 err = utils.ExtractTarGz(filename, fmt.Sprintf("layer_%d", i+1))
                 if err != nil {
-                        log.Fatalf("Error extracting %s: %v\n", filename, err)
-                } else if verbose || debug {
-                        log.Printf("File %s extracted successfully.\n", filename)
+                        layerErrors = append(layerErrors, fmt.Errorf("%w: extracting %s: %v", ErrLayerDownload, filename, err))
+                } else {
+                        slog.Debug("Layer extracted", "chart", chart.String(), "file", filename)
                 }
         }
+        return manifest, errors.Join(layerErrors...)
+}
+
+// Download one layer into a file with a unique name
+func (c *Client) fetchLayer(chart ChartRef, digest, filename string) error {
+        outFile, err := os.Create(filename)
+        if err != nil {
+                return fmt.Errorf("creating file: %v", err)
+        }
+        defer outFile.Close()
+
+        return c.FetchBlob(chart, digest, outFile)
 }
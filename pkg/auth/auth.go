@@ -0,0 +1,249 @@
+package auth
+
+import (
+    "bytes"
+    "encoding/base64"
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/http"
+    "net/url"
+    "os"
+    "os/exec"
+    "path/filepath"
+    "strings"
+    "sync"
+)
+
+// Kinds of credentials an Artifactory or registry request can carry
+const (
+    KindAnonymous = "anonymous"
+    KindBasic     = "basic"
+    KindBearer    = "bearer"
+    KindAPIKey    = "apikey"
+)
+
+// Credential is a single way of authenticating a request
+type Credential struct {
+    Kind     string
+    User     string
+    Password string
+    Token    string
+}
+
+// Parse a credential value. Accepted formats:
+//   user:password       basic auth
+//   bearer:<token>      access token sent as "Authorization: Bearer"
+//   apikey:<key>        API key sent as "X-JFrog-Art-Api"
+//   anonymous or empty  no authentication
+func ParseCredential(value string) (Credential, error) {
+    value = strings.TrimSpace(value)
+    if value == "" || value == KindAnonymous {
+        return Credential{Kind: KindAnonymous}, nil
+    }
+
+    parts := strings.SplitN(value, ":", 2)
+    if len(parts) != 2 || parts[1] == "" {
+        return Credential{}, fmt.Errorf("credential is not properly formatted, e.x. user:pass, bearer:<token>, apikey:<key> or anonymous")
+    }
+
+    switch strings.ToLower(parts[0]) {
+    case KindBearer:
+        return Credential{Kind: KindBearer, Token: parts[1]}, nil
+    case KindAPIKey:
+        return Credential{Kind: KindAPIKey, Token: parts[1]}, nil
+    }
+    return Credential{Kind: KindBasic, User: parts[0], Password: parts[1]}, nil
+}
+
+// Apply sets the authentication headers of the credential on the request
+func (c Credential) Apply(req *http.Request) {
+    switch c.Kind {
+    case KindBasic:
+        req.SetBasicAuth(c.User, c.Password)
+    case KindBearer:
+        req.Header.Set("Authorization", "Bearer "+c.Token)
+    case KindAPIKey:
+        req.Header.Set("X-JFrog-Art-Api", c.Token)
+    }
+}
+
+// Resolver picks the credential of a request by its host: a host specific credential first,
+// then the default credential, then the docker config, and anonymous if nothing matches.
+// The docker config is read once per host, so credential helpers aren't run for every request.
+type Resolver struct {
+    Default      *Credential
+    Hosts        map[string]Credential
+    DockerConfig string
+
+    mu     sync.Mutex
+    docker map[string]Credential
+}
+
+// NewResolver builds a resolver from the configuration values.
+// hostCredentials is a comma separated list of host=credential pairs, dockerConfig the path of a docker config.json.
+func NewResolver(defaultCredential, hostCredentials, dockerConfig string) (*Resolver, error) {
+    resolver := &Resolver{Hosts: make(map[string]Credential), DockerConfig: dockerConfig}
+
+    if strings.TrimSpace(defaultCredential) != "" {
+        credential, err := ParseCredential(defaultCredential)
+        if err != nil {
+            return nil, err
+        }
+        resolver.Default = &credential
+    }
+
+    for _, entry := range strings.Split(hostCredentials, ",") {
+        if strings.TrimSpace(entry) == "" {
+            continue
+        }
+        parts := strings.SplitN(entry, "=", 2)
+        if len(parts) != 2 {
+            return nil, fmt.Errorf("host credential is not properly formatted, e.x. host=user:pass")
+        }
+        credential, err := ParseCredential(parts[1])
+        if err != nil {
+            return nil, fmt.Errorf("credential for %s: %v", parts[0], err)
+        }
+        resolver.Hosts[strings.ToLower(strings.TrimSpace(parts[0]))] = credential
+    }
+    return resolver, nil
+}
+
+// For returns the credential to use for a URL
+func (r *Resolver) For(rawURL string) Credential {
+    host := rawURL
+    if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+        host = u.Host
+    }
+    host = strings.ToLower(host)
+
+    if credential, ok := r.Hosts[host]; ok {
+        return credential
+    }
+    if hostname := strings.Split(host, ":")[0]; hostname != host {
+        if credential, ok := r.Hosts[hostname]; ok {
+            return credential
+        }
+    }
+    if r.Default != nil {
+        return *r.Default
+    }
+    if r.DockerConfig != "" {
+        return r.dockerCredential(host)
+    }
+    return Credential{Kind: KindAnonymous}
+}
+
+// dockerCredential resolves the docker credential of a host on first use, a host without one stays anonymous
+func (r *Resolver) dockerCredential(host string) Credential {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if credential, ok := r.docker[host]; ok {
+        return credential
+    }
+
+    credential, err := dockerCredential(r.DockerConfig, host)
+    if err != nil {
+        credential = Credential{Kind: KindAnonymous}
+    }
+    if r.docker == nil {
+        r.docker = make(map[string]Credential)
+    }
+    r.docker[host] = credential
+    return credential
+}
+
+// Apply sets the authentication headers for the request URL
+func (r *Resolver) Apply(req *http.Request) {
+    r.For(req.URL.String()).Apply(req)
+}
+
+// DefaultDockerConfig returns the docker config.json path, honouring DOCKER_CONFIG
+func DefaultDockerConfig() string {
+    if dir := os.Getenv("DOCKER_CONFIG"); dir != "" {
+        return filepath.Join(dir, "config.json")
+    }
+    home, err := os.UserHomeDir()
+    if err != nil {
+        return ""
+    }
+    return filepath.Join(home, ".docker", "config.json")
+}
+
+type dockerConfigFile struct {
+    Auths map[string]struct {
+        Auth          string `json:"auth"`
+        IdentityToken string `json:"identitytoken"`
+    } `json:"auths"`
+    CredsStore  string            `json:"credsStore"`
+    CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// Look up the credential of a registry host in a docker config.json, asking the credential helper if one is configured
+func dockerCredential(configPath, host string) (Credential, error) {
+    data, err := ioutil.ReadFile(configPath)
+    if err != nil {
+        return Credential{}, err
+    }
+
+    var config dockerConfigFile
+    if err := json.Unmarshal(data, &config); err != nil {
+        return Credential{}, fmt.Errorf("parsing %s: %v", configPath, err)
+    }
+
+    if helper, ok := config.CredHelpers[host]; ok {
+        return helperCredential(helper, host)
+    }
+
+    for registry, entry := range config.Auths {
+        if registryHost(registry) != host {
+            continue
+        }
+        if entry.IdentityToken != "" {
+            return Credential{Kind: KindBearer, Token: entry.IdentityToken}, nil
+        }
+        decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+        if err != nil {
+            return Credential{}, fmt.Errorf("decoding auth of %s: %v", registry, err)
+        }
+        return ParseCredential(string(decoded))
+    }
+
+    if config.CredsStore != "" {
+        return helperCredential(config.CredsStore, host)
+    }
+    return Credential{}, fmt.Errorf("no docker credential for %s", host)
+}
+
+// Ask a docker credential helper, e.x. docker-credential-pass, for the credential of a host
+func helperCredential(helper, host string) (Credential, error) {
+    cmd := exec.Command("docker-credential-"+helper, "get")
+    cmd.Stdin = strings.NewReader(host)
+    var stdout bytes.Buffer
+    cmd.Stdout = &stdout
+    if err := cmd.Run(); err != nil {
+        return Credential{}, fmt.Errorf("running docker-credential-%s: %v", helper, err)
+    }
+
+    var response struct {
+        Username string `json:"Username"`
+        Secret   string `json:"Secret"`
+    }
+    if err := json.Unmarshal(stdout.Bytes(), &response); err != nil {
+        return Credential{}, fmt.Errorf("parsing docker-credential-%s output: %v", helper, err)
+    }
+    // Helpers return "<token>" as the username for identity tokens
+    if response.Username == "<token>" {
+        return Credential{Kind: KindBearer, Token: response.Secret}, nil
+    }
+    return Credential{Kind: KindBasic, User: response.Username, Password: response.Secret}, nil
+}
+
+// Registries in docker config.json may be written as URLs, e.x. https://index.docker.io/v1/
+func registryHost(registry string) string {
+    if u, err := url.Parse(registry); err == nil && u.Host != "" {
+        return strings.ToLower(u.Host)
+    }
+    return strings.ToLower(strings.Split(registry, "/")[0])
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+// A docker credential helper that records every call, to see how often the resolver runs it
+func writeCredentialHelper(t *testing.T) (string, string) {
+    dir := t.TempDir()
+    calls := filepath.Join(dir, "calls")
+    script := "#!/bin/sh\nread host\necho \"$host\" >> " + calls + "\necho '{\"Username\":\"<token>\",\"Secret\":\"secret-'$host'\"}'\n"
+    if err := os.WriteFile(filepath.Join(dir, "docker-credential-count"), []byte(script), 0755); err != nil {
+        t.Fatal(err)
+    }
+    config := filepath.Join(dir, "config.json")
+    if err := os.WriteFile(config, []byte(`{"credHelpers":{"charts.example.com":"count"}}`), 0644); err != nil {
+        t.Fatal(err)
+    }
+    t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+    return config, calls
+}
+
+func TestResolverCachesDockerCredentials(t *testing.T) {
+    config, calls := writeCredentialHelper(t)
+    resolver, err := NewResolver("", "", config)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    for i := 0; i < 3; i++ {
+        credential := resolver.For("https://charts.example.com/v2/team/sample/manifests/1.0.0")
+        if credential.Kind != KindBearer || credential.Token != "secret-charts.example.com" {
+            t.Fatalf("For = %+v, want the bearer token of the helper", credential)
+        }
+        if credential := resolver.For("https://other.example.com/api"); credential.Kind != KindAnonymous {
+            t.Fatalf("For other host = %+v, want anonymous", credential)
+        }
+    }
+
+    data, err := os.ReadFile(calls)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := strings.Fields(string(data)); len(got) != 1 {
+        t.Errorf("credential helper ran %d times, want once: %v", len(got), got)
+    }
+}
+
+func TestResolverPrecedence(t *testing.T) {
+    config, _ := writeCredentialHelper(t)
+    resolver, err := NewResolver("user:password", "charts.example.com=bearer:host-token", config)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if credential := resolver.For("https://charts.example.com:443/api"); credential.Token != "host-token" {
+        t.Errorf("For host = %+v, want the host credential", credential)
+    }
+    if credential := resolver.For("https://other.example.com/api"); credential.Kind != KindBasic || credential.User != "user" {
+        t.Errorf("For other host = %+v, want the default credential", credential)
+    }
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
-    "log"
+    "fmt"
     "os"
+    "strings"
+    "time"
+
+    "sonarcheck/pkg/policy"
+    "sonarcheck/pkg/waiver"
 )
 
 const (
@@ -11,50 +16,257 @@ const (
     CleaningPattern = "layer_*"
     defaultOCIRegistry = "charts-registry"
     defaultChartRepository = "lieferscheine"
+    defaultVersionSources = "appVersion,version,annotation"
+    defaultVersionAnnotation = "sonarcheck/version"
+    defaultPromoteStatus = "sonar-passed"
+    defaultPromoteAuditFile = "sonarcheck-promotion.jsonl"
+    defaultLogLevel = "info"
+    defaultLogFormat = "text"
+    DefaultConfigFile = ".sonarcheck.yaml"
+    SourceChart = "chart"
+    SourceBuildInfo = "buildinfo"
 )
 
 var (
-    Verbose           bool
-    Debug             bool
+    LogLevel          string
+    LogFormat         string
+    HTTPTraceBodies   bool
+    HTTPTraceHAR      string
+    HTTPTimeout       time.Duration
     SonarQubeURL      string
     JfrogURL          string
     SonarQubeToken    string
+    SonarQubeAuth     string
     JfrogCredentials  string
+    JfrogHostCredentials string
+    DockerConfig      string
     OCIRegistry       string
     ChartRepository   string
     ChartName         string
     ChartVersion      string
+    InternalOrigins   []string
+    VersionSources    []string
+    VersionAnnotation string
+    DependencySource  string
+    BuildName         string
+    BuildNumber       string
+    BuildInfoFile     string
+    PublishProperties bool
+    PromoteTargetRepo string
+    PromoteStatus     string
+    PromoteComment    string
+    PromoteDryRun     bool
+    PromoteAuditFile  string
+    TLSCABundle       string
+    TLSClientCert     string
+    TLSClientKey      string
+    TLSInsecure       bool
+    IgnoreRules       string
+    Components        []ComponentOverride
+    WaiversFile       string
+    Policies          []PolicyRule
+    Decision          policy.Decision
+    ReportJSON        string
+    ReportJUnit       string
+    ReportSARIF       string
+    ReportMarkdown    string
+    ReportHTML        string
+    Waivers           []waiver.Waiver
+    ConfigFile        string
 )
 
-func LoadEnv() {
-    SonarQubeURL = getEnv("SONARQUBE_URL", defaultSonarQubeURL)
-    JfrogURL = getEnv("JFROG_URL", defaultJfrogURL)
-    OCIRegistry = getEnv("OCI_REGISTRY", defaultOCIRegistry)
-    ChartRepository = getEnv("CHART_REPOSITORY", defaultChartRepository)
-    SonarQubeToken = mustGetEnv("SONARQUBE_TOKEN")
-    JfrogCredentials = mustGetEnv("JFROG_CREDENTIALS")
-    ChartName = mustGetEnv("CHART_NAME")
-    ChartVersion = mustGetEnv("CHART_VERSION")
+// Load resolves every setting with the precedence flags > env > config file > defaults.
+// Flags have to be parsed before, see RegisterFlags. Without SONARCHECK_CONFIG the config file is
+// DefaultConfigFile, which may be missing; a config file that was asked for explicitly has to exist.
+func Load() error {
+    configFile := layered("SONARCHECK_CONFIG", "", "")
+    explicit := configFile != ""
+    if !explicit {
+        configFile = DefaultConfigFile
+    }
+
+    file, err := readFile(configFile, explicit)
+    if err != nil {
+        return err
+    }
+    if file != nil {
+        ConfigFile = configFile
+    } else {
+        file = &File{}
+    }
+
+    SonarQubeURL = layered("SONARQUBE_URL", file.SonarQube.URL, defaultSonarQubeURL)
+    JfrogURL = layered("JFROG_URL", file.Jfrog.URL, defaultJfrogURL)
+    OCIRegistry = layered("OCI_REGISTRY", file.Chart.Registry, defaultOCIRegistry)
+    ChartRepository = layered("CHART_REPOSITORY", file.Chart.Repository, defaultChartRepository)
+    ChartName = layered("CHART_NAME", file.Chart.Name, "")
+    ChartVersion = layered("CHART_VERSION", file.Chart.Version, "")
+    SonarQubeToken = layered("SONARQUBE_TOKEN", file.SonarQube.Token, "")
+    SonarQubeAuth = layered("SONARQUBE_AUTH", file.SonarQube.Auth, "auto")
+    JfrogCredentials = layered("JFROG_CREDENTIALS", file.Jfrog.Credentials, "")
+    JfrogHostCredentials = layered("JFROG_HOST_CREDENTIALS", joinMap(file.Jfrog.HostCredentials), "")
+    DockerConfig = layered("DOCKER_CONFIG_FILE", file.Jfrog.DockerConfig, "")
+    BuildName = layered("BUILD_NAME", file.Build.Name, "")
+    BuildNumber = layered("BUILD_NUMBER", file.Build.Number, "")
+    BuildInfoFile = layered("BUILD_INFO_FILE", file.Build.File, "")
+    defaultSource := SourceChart
+    if BuildInfoFile != "" || BuildName != "" {
+        defaultSource = SourceBuildInfo
+    }
+    DependencySource = layered("DEPENDENCY_SOURCE", file.Source, defaultSource)
+
+    InternalOrigins = splitList(layered("INTERNAL_ORIGINS", strings.Join(file.InternalOrigins, ","), ""))
+    VersionSources = splitList(layered("VERSION_SOURCES", strings.Join(file.Versions.Sources, ","), defaultVersionSources))
+    VersionAnnotation = layered("VERSION_ANNOTATION", file.Versions.Annotation, defaultVersionAnnotation)
+    IgnoreRules = layered("IGNORE_RULES", strings.Join(file.IgnoreRules, ","), "")
+    Components = file.Components
+    WaiversFile = layered("WAIVERS_FILE", file.WaiversFile, "")
+    Policies = file.Policies
+    Decision = file.Decision
+    Decision.Fail = layered("FAIL_WHEN", file.Decision.Fail, "")
+    ReportJSON = layered("REPORT_JSON", file.Output.ReportJSON, "")
+    ReportJUnit = layered("REPORT_JUNIT", file.Output.ReportJUnit, "")
+    ReportSARIF = layered("REPORT_SARIF", file.Output.ReportSARIF, "")
+    ReportMarkdown = layered("REPORT_MARKDOWN", file.Output.ReportMarkdown, "")
+    ReportHTML = layered("REPORT_HTML", file.Output.ReportHTML, "")
+
+    PromoteTargetRepo = layered("PROMOTE_TARGET_REPO", file.Promote.TargetRepo, "")
+    PromoteStatus = layered("PROMOTE_STATUS", file.Promote.Status, defaultPromoteStatus)
+    PromoteComment = layered("PROMOTE_COMMENT", file.Promote.Comment, "")
+    PromoteAuditFile = layered("PROMOTE_AUDIT_FILE", file.Promote.AuditFile, defaultPromoteAuditFile)
+
+    TLSCABundle = layered("TLS_CA_BUNDLE", file.TLS.CABundle, "")
+    TLSClientCert = layered("TLS_CLIENT_CERT", file.TLS.ClientCert, "")
+    TLSClientKey = layered("TLS_CLIENT_KEY", file.TLS.ClientKey, "")
 
-    if os.Getenv("VERBOSE") == "true" {
-        Verbose = true
+    TLSInsecure = layeredBool("TLS_INSECURE", file.TLS.Insecure)
+    PromoteDryRun = layeredBool("PROMOTE_DRY_RUN", file.Promote.DryRun)
+    PublishProperties = layeredBool("PUBLISH_PROPERTIES", file.Output.PublishProperties)
+
+    LogLevel = layeredLogLevel(file.Output.LogLevel)
+    LogFormat = layered("LOG_FORMAT", file.Output.LogFormat, defaultLogFormat)
+    HTTPTraceBodies = layeredBool("HTTP_TRACE_BODIES", file.Output.HTTPTraceBodies)
+    HTTPTraceHAR = layered("HTTP_TRACE_HAR", file.Output.HTTPTraceHAR, "")
+
+    // Empty means httpclient.DefaultTimeout (2m), the cap of every call including the chart layer downloads
+    HTTPTimeout = 0
+    if timeout := layered("HTTP_TIMEOUT", file.HTTPTimeout, ""); timeout != "" {
+        HTTPTimeout, err = time.ParseDuration(timeout)
+        if err != nil || HTTPTimeout <= 0 {
+            return fmt.Errorf("HTTP_TIMEOUT must be a positive duration, e.x. 30s or 5m, got %s", timeout)
+        }
+    }
+    return nil
+}
+
+// Validate checks the settings a command can't run without, the token only when SonarQube is queried
+func Validate(requireSonarQube bool) error {
+    var missing []string
+    if requireSonarQube && SonarQubeToken == "" {
+        missing = append(missing, "SONARQUBE_TOKEN")
+    }
+
+    switch DependencySource {
+    case SourceChart:
+        if ChartName == "" {
+            missing = append(missing, "CHART_NAME")
+        }
+        if ChartVersion == "" {
+            missing = append(missing, "CHART_VERSION")
+        }
+    case SourceBuildInfo:
+        if BuildInfoFile == "" && BuildName == "" {
+            missing = append(missing, "BUILD_NAME")
+        }
+        if BuildInfoFile == "" && BuildNumber == "" {
+            missing = append(missing, "BUILD_NUMBER")
+        }
+    default:
+        return fmt.Errorf("DEPENDENCY_SOURCE must be %s or %s, got %s", SourceChart, SourceBuildInfo, DependencySource)
+    }
+
+    if len(missing) > 0 {
+        return fmt.Errorf("%s not set in flags, environment or config file", strings.Join(missing, ", "))
+    }
+    for i := range Components {
+        if err := Components[i].compile(); err != nil {
+            return err
+        }
     }
-    if os.Getenv("DEBUG") == "true" {
-        Debug = true
+    for i := range Policies {
+        if err := Policies[i].compile(); err != nil {
+            return err
+        }
     }
+    if err := Decision.Compile(); err != nil {
+        return err
+    }
+
+    Waivers = nil
+    if WaiversFile != "" {
+        waivers, err := waiver.Load(WaiversFile)
+        if err != nil {
+            return err
+        }
+        Waivers = waivers
+    }
+    return nil
 }
 
-func getEnv(key, defaultValue string) string {
+// layered returns the flag value or the env value if either is set, the config file value if it isn't empty,
+// otherwise the default
+func layered(key, fileValue, defaultValue string) string {
+    if value, exists := flagValues[key]; exists {
+        return value
+    }
     if value, exists := os.LookupEnv(key); exists {
         return value
     }
+    if fileValue != "" {
+        return fileValue
+    }
     return defaultValue
 }
 
-func mustGetEnv(key string) string {
-    value, exists := os.LookupEnv(key)
-    if !exists {
-        log.Fatalf("[ERROR] %s environment variable not set", key)
+// layeredBool is layered for switches, only "true" enables them in flags and env
+func layeredBool(key string, fileValue bool) bool {
+    if value, exists := flagValues[key]; exists {
+        return value == "true"
+    }
+    if value, exists := os.LookupEnv(key); exists {
+        return value == "true"
+    }
+    return fileValue
+}
+
+// layeredLogLevel is layered for LOG_LEVEL. VERBOSE and DEBUG are from before LOG_LEVEL, both mean the debug level
+// at their own layer, so a -log-level flag wins over a DEBUG env and a -debug flag over a LOG_LEVEL env.
+func layeredLogLevel(fileValue string) string {
+    if value, exists := flagValues["LOG_LEVEL"]; exists {
+        return value
+    }
+    if flagValues["VERBOSE"] == "true" || flagValues["DEBUG"] == "true" {
+        return "debug"
+    }
+    if value, exists := os.LookupEnv("LOG_LEVEL"); exists {
+        return value
+    }
+    if os.Getenv("VERBOSE") == "true" || os.Getenv("DEBUG") == "true" {
+        return "debug"
+    }
+    if fileValue != "" {
+        return fileValue
+    }
+    return defaultLogLevel
+}
+
+// splitList turns a comma separated value into a list, dropping empty entries
+func splitList(value string) []string {
+    var list []string
+    for _, item := range strings.Split(value, ",") {
+        if item = strings.TrimSpace(item); item != "" {
+            list = append(list, item)
+        }
     }
-    return value
+    return list
 }
@@ -0,0 +1,317 @@
+package config
+
+import (
+    "fmt"
+    "io"
+    "io/ioutil"
+    "os"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "time"
+
+    "gopkg.in/yaml.v2"
+
+    "sonarcheck/pkg/policy"
+    "sonarcheck/pkg/utils"
+)
+
+// File is the layout of .sonarcheck.yaml
+type File struct {
+    SonarQube struct {
+        URL   string `yaml:"url,omitempty"`
+        Token string `yaml:"token,omitempty"`
+        Auth  string `yaml:"auth,omitempty"`
+    } `yaml:"sonarqube"`
+    Jfrog struct {
+        URL             string            `yaml:"url,omitempty"`
+        Credentials     string            `yaml:"credentials,omitempty"`
+        HostCredentials map[string]string `yaml:"hostCredentials,omitempty"`
+        DockerConfig    string            `yaml:"dockerConfig,omitempty"`
+    } `yaml:"jfrog"`
+    Chart struct {
+        Registry   string `yaml:"registry,omitempty"`
+        Repository string `yaml:"repository,omitempty"`
+        Name       string `yaml:"name,omitempty"`
+        Version    string `yaml:"version,omitempty"`
+    } `yaml:"chart"`
+    Source string `yaml:"source,omitempty"`
+    Build  struct {
+        Name   string `yaml:"name,omitempty"`
+        Number string `yaml:"number,omitempty"`
+        File   string `yaml:"file,omitempty"`
+    } `yaml:"build"`
+    Versions struct {
+        Sources    []string `yaml:"sources,omitempty"`
+        Annotation string   `yaml:"annotation,omitempty"`
+    } `yaml:"versions"`
+    InternalOrigins []string            `yaml:"internalOrigins,omitempty"`
+    IgnoreRules     []string            `yaml:"ignoreRules,omitempty"`
+    Components      []ComponentOverride `yaml:"components,omitempty"`
+    WaiversFile     string              `yaml:"waiversFile,omitempty"`
+    Policies        []PolicyRule        `yaml:"policies,omitempty"`
+    Decision        policy.Decision     `yaml:"decision,omitempty"`
+    HTTPTimeout     string              `yaml:"httpTimeout,omitempty"`
+    Output          struct {
+        LogLevel          string `yaml:"logLevel,omitempty"`
+        LogFormat         string `yaml:"logFormat,omitempty"`
+        HTTPTraceBodies   bool   `yaml:"httpTraceBodies,omitempty"`
+        HTTPTraceHAR      string `yaml:"httpTraceHar,omitempty"`
+        PublishProperties bool   `yaml:"publishProperties,omitempty"`
+        ReportJSON        string `yaml:"reportJson,omitempty"`
+        ReportJUnit       string `yaml:"reportJunit,omitempty"`
+        ReportSARIF       string `yaml:"reportSarif,omitempty"`
+        ReportMarkdown    string `yaml:"reportMarkdown,omitempty"`
+        ReportHTML        string `yaml:"reportHtml,omitempty"`
+    } `yaml:"output"`
+    Promote struct {
+        TargetRepo string `yaml:"targetRepo,omitempty"`
+        Status     string `yaml:"status,omitempty"`
+        Comment    string `yaml:"comment,omitempty"`
+        DryRun     bool   `yaml:"dryRun,omitempty"`
+        AuditFile  string `yaml:"auditFile,omitempty"`
+    } `yaml:"promote"`
+    TLS struct {
+        CABundle   string `yaml:"caBundle,omitempty"`
+        ClientCert string `yaml:"clientCert,omitempty"`
+        ClientKey  string `yaml:"clientKey,omitempty"`
+        Insecure   bool   `yaml:"insecure,omitempty"`
+    } `yaml:"tls"`
+}
+
+// ComponentOverride changes how the components matching the pattern are checked
+type ComponentOverride struct {
+    Pattern    string `yaml:"pattern"`
+    Ignore     bool   `yaml:"ignore,omitempty"`
+    ProjectKey string `yaml:"projectKey,omitempty"`
+    Version    string `yaml:"version,omitempty"`
+
+    re *regexp.Regexp
+}
+
+// The pattern has to match the whole component name, like the ignore rules
+func (o *ComponentOverride) compile() error {
+    re, err := regexp.Compile("^" + o.Pattern + "$")
+    if err != nil {
+        return fmt.Errorf("compiling component pattern '%s': %v", o.Pattern, err)
+    }
+    o.re = re
+    return nil
+}
+
+// FindOverride returns the first component override matching the name, nil if none does
+func FindOverride(name string) *ComponentOverride {
+    for i := range Components {
+        override := &Components[i]
+        if override.re == nil && override.compile() != nil {
+            continue
+        }
+        if override.re.MatchString(name) {
+            return override
+        }
+    }
+    return nil
+}
+
+// PolicyRule sets the policy of the components matching the name pattern or the path pattern
+type PolicyRule struct {
+    Pattern        string `yaml:"pattern,omitempty"`
+    Path           string `yaml:"path,omitempty"`
+    WarnOnly       bool   `yaml:"warnOnly,omitempty"`
+    AllowWarn      bool   `yaml:"allowWarn,omitempty"`
+    StrictVersion  bool   `yaml:"strictVersion,omitempty"`
+    MaxAnalysisAge string `yaml:"maxAnalysisAge,omitempty"`
+    Branch         string   `yaml:"branch,omitempty"`
+    Labels         []string `yaml:"labels,omitempty"`
+
+    re       *regexp.Regexp
+    pathRe   *regexp.Regexp
+    maxAge   time.Duration
+    compiled bool
+}
+
+// Both patterns have to match the whole value, a rule without patterns matches every component
+func (r *PolicyRule) compile() error {
+    var err error
+    if r.Pattern != "" {
+        if r.re, err = regexp.Compile("^" + r.Pattern + "$"); err != nil {
+            return fmt.Errorf("compiling policy pattern '%s': %v", r.Pattern, err)
+        }
+    }
+    if r.Path != "" {
+        if r.pathRe, err = regexp.Compile("^" + r.Path + "$"); err != nil {
+            return fmt.Errorf("compiling policy path '%s': %v", r.Path, err)
+        }
+    }
+    if r.maxAge, err = parseAge(r.MaxAnalysisAge); err != nil {
+        return fmt.Errorf("policy maxAnalysisAge '%s': %v", r.MaxAnalysisAge, err)
+    }
+    r.compiled = true
+    return nil
+}
+
+func (r *PolicyRule) matches(component utils.Component) bool {
+    if r.re != nil && !r.re.MatchString(component.Name) {
+        return false
+    }
+    if r.pathRe != nil && !r.pathRe.MatchString(component.Path) {
+        return false
+    }
+    return true
+}
+
+// FindPolicy returns the policy of the first rule matching the component, the default policy if none does
+func FindPolicy(component utils.Component) policy.Policy {
+    for i := range Policies {
+        rule := &Policies[i]
+        if !rule.compiled && rule.compile() != nil {
+            continue
+        }
+        if !rule.matches(component) {
+            continue
+        }
+        return policy.Policy{
+            WarnOnly:       rule.WarnOnly,
+            AllowWarn:      rule.AllowWarn,
+            StrictVersion:  rule.StrictVersion,
+            MaxAnalysisAge: rule.maxAge,
+            Branch:         rule.Branch,
+            Labels:         rule.Labels,
+        }
+    }
+    return policy.Policy{}
+}
+
+// parseAge accepts Go durations and whole days, e.x. 72h or 30d
+func parseAge(age string) (time.Duration, error) {
+    if age == "" {
+        return 0, nil
+    }
+    if strings.HasSuffix(age, "d") {
+        days, err := strconv.Atoi(strings.TrimSuffix(age, "d"))
+        if err != nil {
+            return 0, err
+        }
+        return time.Duration(days) * 24 * time.Hour, nil
+    }
+    return time.ParseDuration(age)
+}
+
+// readFile parses the config file, a missing file is only an error when it was asked for explicitly
+func readFile(path string, explicit bool) (*File, error) {
+    data, err := ioutil.ReadFile(path)
+    if os.IsNotExist(err) && !explicit {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("reading config file: %v", err)
+    }
+
+    var file File
+    if err := yaml.UnmarshalStrict(data, &file); err != nil {
+        return nil, fmt.Errorf("parsing config file %s: %v", path, err)
+    }
+    return &file, nil
+}
+
+// Print writes the resolved settings as a config file, with tokens and passwords redacted
+func Print(w io.Writer) error {
+    var file File
+    file.SonarQube.URL = SonarQubeURL
+    file.SonarQube.Token = redact(SonarQubeToken)
+    file.SonarQube.Auth = SonarQubeAuth
+    file.Jfrog.URL = JfrogURL
+    file.Jfrog.Credentials = redactCredential(JfrogCredentials)
+    file.Jfrog.DockerConfig = DockerConfig
+    for _, entry := range splitList(JfrogHostCredentials) {
+        parts := strings.SplitN(entry, "=", 2)
+        if file.Jfrog.HostCredentials == nil {
+            file.Jfrog.HostCredentials = make(map[string]string)
+        }
+        if len(parts) == 2 {
+            file.Jfrog.HostCredentials[parts[0]] = redactCredential(parts[1])
+        }
+    }
+    file.Chart.Registry = OCIRegistry
+    file.Chart.Repository = ChartRepository
+    file.Chart.Name = ChartName
+    file.Chart.Version = ChartVersion
+    file.Source = DependencySource
+    file.Build.Name = BuildName
+    file.Build.Number = BuildNumber
+    file.Build.File = BuildInfoFile
+    file.Versions.Sources = VersionSources
+    file.Versions.Annotation = VersionAnnotation
+    file.InternalOrigins = InternalOrigins
+    file.IgnoreRules = splitList(IgnoreRules)
+    file.Components = Components
+    file.WaiversFile = WaiversFile
+    file.Policies = Policies
+    file.Decision = Decision
+    if HTTPTimeout > 0 {
+        file.HTTPTimeout = HTTPTimeout.String()
+    }
+    file.Output.LogLevel = LogLevel
+    file.Output.LogFormat = LogFormat
+    file.Output.HTTPTraceBodies = HTTPTraceBodies
+    file.Output.HTTPTraceHAR = HTTPTraceHAR
+    file.Output.PublishProperties = PublishProperties
+    file.Output.ReportJSON = ReportJSON
+    file.Output.ReportJUnit = ReportJUnit
+    file.Output.ReportSARIF = ReportSARIF
+    file.Output.ReportMarkdown = ReportMarkdown
+    file.Output.ReportHTML = ReportHTML
+    file.Promote.TargetRepo = PromoteTargetRepo
+    file.Promote.Status = PromoteStatus
+    file.Promote.Comment = PromoteComment
+    file.Promote.DryRun = PromoteDryRun
+    file.Promote.AuditFile = PromoteAuditFile
+    file.TLS.CABundle = TLSCABundle
+    file.TLS.ClientCert = TLSClientCert
+    file.TLS.ClientKey = TLSClientKey
+    file.TLS.Insecure = TLSInsecure
+
+    data, err := yaml.Marshal(&file)
+    if err != nil {
+        return err
+    }
+    if ConfigFile != "" {
+        fmt.Fprintf(w, "# resolved from flags, env, %s and defaults\n", ConfigFile)
+    } else {
+        fmt.Fprintf(w, "# resolved from flags, env and defaults\n")
+    }
+    _, err = w.Write(data)
+    return err
+}
+
+func redact(secret string) string {
+    if secret == "" {
+        return ""
+    }
+    return "REDACTED"
+}
+
+// Keep the user and the kind of a credential visible, e.x. "user:REDACTED" or "bearer:REDACTED"
+func redactCredential(credential string) string {
+    parts := strings.SplitN(credential, ":", 2)
+    if len(parts) != 2 {
+        return redact(credential)
+    }
+    return parts[0] + ":" + redact(parts[1])
+}
+
+// joinMap turns host credentials from the config file into the JFROG_HOST_CREDENTIALS format
+func joinMap(values map[string]string) string {
+    keys := make([]string, 0, len(values))
+    for key := range values {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    pairs := make([]string, 0, len(keys))
+    for _, key := range keys {
+        pairs = append(pairs, key+"="+values[key])
+    }
+    return strings.Join(pairs, ",")
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+    "flag"
+)
+
+// Settings given as flags, keyed by their env name. They win over env and the config file.
+var flagValues = make(map[string]string)
+
+type setting struct {
+    flag   string
+    env    string
+    usage  string
+    isBool bool
+}
+
+// Every setting has a flag named after its env variable
+var settings = []setting{
+    {"config", "SONARCHECK_CONFIG", "Path of the config file (default: .sonarcheck.yaml)", false},
+    {"sonarqube-url", "SONARQUBE_URL", "The URL of the sonarqube instance", false},
+    {"sonarqube-token", "SONARQUBE_TOKEN", "Token that you need to check the status of applications", false},
+    {"sonarqube-auth", "SONARQUBE_AUTH", "How to send the token: auto, bearer or basic", false},
+    {"jfrog-url", "JFROG_URL", "The URL of the jfrog instance", false},
+    {"jfrog-credentials", "JFROG_CREDENTIALS", "Artifactory credentials e.x. user:password, bearer:<token>, apikey:<key> or anonymous", false},
+    {"jfrog-host-credentials", "JFROG_HOST_CREDENTIALS", "Comma separated host=credential pairs", false},
+    {"docker-config", "DOCKER_CONFIG_FILE", "Docker config.json used to look up registry credentials", false},
+    {"oci-registry", "OCI_REGISTRY", "OCI registry (Artifactory repository) holding the umbrella chart", false},
+    {"chart-repository", "CHART_REPOSITORY", "Repository path of the umbrella chart inside the registry", false},
+    {"chart-name", "CHART_NAME", "Umbrella chart name", false},
+    {"chart-version", "CHART_VERSION", "Umbrella chart version", false},
+    {"source", "DEPENDENCY_SOURCE", "Where to find the components: chart or buildinfo", false},
+    {"build-name", "BUILD_NAME", "JFrog build name to read dependencies from", false},
+    {"build-number", "BUILD_NUMBER", "JFrog build number", false},
+    {"build-info-file", "BUILD_INFO_FILE", "Exported build-info JSON file to read dependencies from", false},
+    {"internal-origins", "INTERNAL_ORIGINS", "Comma separated hosts or URL prefixes of internal charts", false},
+    {"version-sources", "VERSION_SOURCES", "Comma separated order to resolve component versions", false},
+    {"version-annotation", "VERSION_ANNOTATION", "Chart annotation holding the version for the annotation source", false},
+    {"ignore-rules", "IGNORE_RULES", "Comma separated ignore patterns", false},
+    {"fail-when", "FAIL_WHEN", "Expression deciding when the check fails (default: count(severity == \"error\") > 0)", false},
+    {"waivers-file", "WAIVERS_FILE", "YAML file of waivers with reason, owner, ticket and expiry", false},
+    {"publish-properties", "PUBLISH_PROPERTIES", "Write the result onto the umbrella chart manifest in Artifactory", true},
+    {"promote-target-repo", "PROMOTE_TARGET_REPO", "Repository to promote into", false},
+    {"promote-status", "PROMOTE_STATUS", "Status recorded by the build promotion", false},
+    {"promote-comment", "PROMOTE_COMMENT", "Comment recorded by the build promotion", false},
+    {"promote-dry-run", "PROMOTE_DRY_RUN", "Only simulate the promotion", true},
+    {"promote-audit-file", "PROMOTE_AUDIT_FILE", "JSON lines file recording every promotion decision", false},
+    {"tls-ca-bundle", "TLS_CA_BUNDLE", "PEM file with extra CA certificates to trust", false},
+    {"tls-client-cert", "TLS_CLIENT_CERT", "PEM client certificate for mutual TLS", false},
+    {"tls-client-key", "TLS_CLIENT_KEY", "PEM private key of the client certificate", false},
+    {"tls-insecure", "TLS_INSECURE", "Skip TLS certificate verification, never use this outside of testing", true},
+    {"http-timeout", "HTTP_TIMEOUT", "Timeout of every HTTP call, chart layer downloads included, e.x. 30s or 5m (default: 2m)", false},
+    {"report-json", "REPORT_JSON", "Write a JSON report of the check to this file", false},
+    {"report-junit", "REPORT_JUNIT", "Write a JUnit XML report of the check to this file", false},
+    {"report-sarif", "REPORT_SARIF", "Write a SARIF 2.1.0 report of the failing components to this file", false},
+    {"report-markdown", "REPORT_MARKDOWN", "Append a Markdown summary of the check to this file", false},
+    {"report-html", "REPORT_HTML", "Write a self-contained HTML report of the check to this file", false},
+    {"log-level", "LOG_LEVEL", "Log level: debug, info, warn or error (default: info)", false},
+    {"log-format", "LOG_FORMAT", "Log format: text or json (default: text)", false},
+    {"http-trace-bodies", "HTTP_TRACE_BODIES", "Log the bodies of HTTP calls at the debug level, credentials redacted", true},
+    {"http-trace-har", "HTTP_TRACE_HAR", "Write every HTTP call to this HAR file, credentials redacted", false},
+    {"verbose", "VERBOSE", "Deprecated, same as -log-level debug", true},
+    {"debug", "DEBUG", "Deprecated, same as -log-level debug", true},
+}
+
+// Short flags kept from the first versions of the CLI
+var aliases = map[string]string{
+    "v":       "VERBOSE",
+    "d":       "DEBUG",
+    "dry-run": "PROMOTE_DRY_RUN",
+}
+
+// settingValue stores a flag into flagValues
+type settingValue struct {
+    env    string
+    isBool bool
+}
+
+func (v settingValue) String() string {
+    return flagValues[v.env]
+}
+
+func (v settingValue) Set(value string) error {
+    flagValues[v.env] = value
+    return nil
+}
+
+func (v settingValue) IsBoolFlag() bool {
+    return v.isBool
+}
+
+// RegisterFlags adds a flag for every setting to the flag set
+func RegisterFlags(fs *flag.FlagSet) {
+    for _, s := range settings {
+        fs.Var(settingValue{env: s.env, isBool: s.isBool}, s.flag, s.usage+" (env "+s.env+")")
+    }
+    for alias, env := range aliases {
+        fs.Var(settingValue{env: env, isBool: true}, alias, "Short for the "+env+" setting")
+    }
+}
@@ -0,0 +1,22 @@
+package exitcode
+
+import (
+    "fmt"
+    "log/slog"
+    "os"
+)
+
+// Exit codes of sonarcheck, so pipelines can tell a failed quality gate from a broken tool
+const (
+    Passed      = 0 // every checked component passed the quality gate
+    GateFailed  = 1 // one or more components failed the quality gate or have no usable status
+    NotFound    = 2 // one or more components have no SonarQube project, the others passed
+    ConfigError = 3 // missing or invalid settings, flags, credentials or ignore rules
+    Unavailable = 4 // SonarQube or Artifactory could not be reached or answered with an error
+)
+
+// Fatalf logs the message as an error and exits with the code
+func Fatalf(code int, format string, v ...interface{}) {
+    slog.Error(fmt.Sprintf(format, v...), "exitCode", code)
+    os.Exit(code)
+}
@@ -0,0 +1,109 @@
+package httpclient
+
+import (
+    "crypto/tls"
+    "crypto/x509"
+    "errors"
+    "fmt"
+    "io/ioutil"
+    "log/slog"
+    "net/http"
+    "strings"
+    "time"
+)
+
+// Settings for every outgoing request to SonarQube and Artifactory
+type Settings struct {
+    CABundle    string
+    ClientCert  string
+    ClientKey   string
+    Insecure    bool
+    Timeout     time.Duration // of a whole request, zero means DefaultTimeout
+    TraceBodies bool   // log the bodies of the calls at the debug level, credentials redacted
+    TraceHAR    string // write every call to this HAR file, credentials redacted
+    Version     string // of SonarCheck, recorded in the HAR file
+}
+
+// DefaultTimeout bounds every request, chart layers included, when Settings.Timeout isn't set
+const DefaultTimeout = 2 * time.Minute
+
+// The shared client, replaced by Configure
+var client = &http.Client{Transport: &tracingTransport{next: newTransport(&tls.Config{})}, Timeout: DefaultTimeout, CheckRedirect: checkRedirect}
+
+// Client returns the shared client all packages send their requests with
+func Client() *http.Client {
+    return client
+}
+
+// Configure builds the shared client from the settings.
+// Proxies come from HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+func Configure(settings Settings) error {
+    tlsConfig := &tls.Config{}
+
+    if settings.CABundle != "" {
+        pool, err := x509.SystemCertPool()
+        if err != nil || pool == nil {
+            pool = x509.NewCertPool()
+        }
+        pem, err := ioutil.ReadFile(settings.CABundle)
+        if err != nil {
+            return fmt.Errorf("reading CA bundle: %v", err)
+        }
+        if !pool.AppendCertsFromPEM(pem) {
+            return fmt.Errorf("no certificates found in CA bundle %s", settings.CABundle)
+        }
+        tlsConfig.RootCAs = pool
+    }
+
+    if settings.ClientCert != "" || settings.ClientKey != "" {
+        if settings.ClientCert == "" || settings.ClientKey == "" {
+            return fmt.Errorf("client certificate and key must be set together")
+        }
+        certificate, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+        if err != nil {
+            return fmt.Errorf("loading client certificate: %v", err)
+        }
+        tlsConfig.Certificates = []tls.Certificate{certificate}
+    }
+
+    if settings.Insecure {
+        slog.Warn("!!! TLS certificate verification is DISABLED, connections can be intercepted !!!")
+        tlsConfig.InsecureSkipVerify = true
+    }
+
+    transport := &tracingTransport{next: newTransport(tlsConfig), bodies: settings.TraceBodies}
+    if settings.TraceHAR != "" {
+        transport.har = newHARRecorder(settings.TraceHAR, settings.Version)
+    }
+    timeout := settings.Timeout
+    if timeout <= 0 {
+        timeout = DefaultTimeout
+    }
+    client = &http.Client{
+        Transport:     transport,
+        Timeout:       timeout,
+        CheckRedirect: checkRedirect,
+    }
+    return nil
+}
+
+// checkRedirect keeps the credentials with the host they were set for. Go only drops Authorization and Cookie
+// on a redirect to another domain, the X-JFrog-Art-Api header of an API key would follow it.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+    if len(via) >= 10 {
+        return errors.New("stopped after 10 redirects")
+    }
+    if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+        for name := range secretHeaders {
+            req.Header.Del(name)
+        }
+    }
+    return nil
+}
+
+func newTransport(tlsConfig *tls.Config) *http.Transport {
+    transport := http.DefaultTransport.(*http.Transport).Clone()
+    transport.Proxy = http.ProxyFromEnvironment
+    transport.TLSClientConfig = tlsConfig
+    return transport
+}
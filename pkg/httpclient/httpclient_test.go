@@ -0,0 +1,85 @@
+package httpclient
+
+import (
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+)
+
+func TestConfigureTimeout(t *testing.T) {
+    if got := Client().Timeout; got != DefaultTimeout {
+        t.Errorf("timeout before Configure = %s, want %s", got, DefaultTimeout)
+    }
+
+    tests := []struct {
+        timeout time.Duration
+        want    time.Duration
+    }{
+        {0, DefaultTimeout},
+        {30 * time.Second, 30 * time.Second},
+    }
+    for _, test := range tests {
+        if err := Configure(Settings{Timeout: test.timeout}); err != nil {
+            t.Fatalf("Configure: %v", err)
+        }
+        if got := Client().Timeout; got != test.want {
+            t.Errorf("Configure with timeout %s: client timeout = %s, want %s", test.timeout, got, test.want)
+        }
+    }
+}
+
+// The API key of Artifactory stays with Artifactory, e.x. when a download redirects to a storage bucket
+func TestRedirectDropsCredentialsForOtherHosts(t *testing.T) {
+    var got http.Header
+    other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        got = r.Header.Clone()
+    }))
+    defer other.Close()
+    artifactory := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        switch r.URL.Path {
+        case "/elsewhere":
+            http.Redirect(w, r, other.URL+"/blob", http.StatusFound)
+        case "/here":
+            http.Redirect(w, r, "/blob", http.StatusFound)
+        default:
+            got = r.Header.Clone()
+        }
+    }))
+    defer artifactory.Close()
+
+    if err := Configure(Settings{}); err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        path     string
+        wantKept bool
+    }{
+        {"/here", true},
+        {"/elsewhere", false},
+    }
+    for _, test := range tests {
+        got = nil
+        req, err := http.NewRequest("GET", artifactory.URL+test.path, nil)
+        if err != nil {
+            t.Fatal(err)
+        }
+        req.Header.Set("X-JFrog-Art-Api", "AKCp5")
+        req.Header.Set("Authorization", "Bearer token")
+        req.Header.Set("Accept", "application/json")
+        resp, err := Client().Do(req)
+        if err != nil {
+            t.Fatalf("GET %s: %v", test.path, err)
+        }
+        resp.Body.Close()
+
+        for _, name := range []string{"X-JFrog-Art-Api", "Authorization"} {
+            if kept := got.Get(name) != ""; kept != test.wantKept {
+                t.Errorf("redirect of %s: %s kept = %t, want %t", test.path, name, kept, test.wantKept)
+            }
+        }
+        if got.Get("Accept") != "application/json" {
+            t.Errorf("redirect of %s dropped the Accept header", test.path)
+        }
+    }
+}
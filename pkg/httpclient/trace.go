@@ -0,0 +1,343 @@
+package httpclient
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "log/slog"
+    "net/http"
+    "net/url"
+    "regexp"
+    "sort"
+    "strings"
+    "sync"
+    "time"
+)
+
+// Tracing of every call through the shared transport. Method, URL, status and latency are logged at the debug
+// level, bodies only when asked for. Credentials are redacted before anything is logged or written to the HAR file.
+
+const redacted = "REDACTED"
+
+// Bodies larger than this are cut, layers and other binary content are never dumped
+const maxTraceBody = 64 * 1024
+
+// Headers that carry credentials
+var secretHeaders = map[string]bool{
+    "Authorization":       true,
+    "Proxy-Authorization": true,
+    "Cookie":              true,
+    "Set-Cookie":          true,
+    "X-Jfrog-Art-Api":     true,
+}
+
+// Query parameters and body fields whose name looks like a credential
+var secretName = regexp.MustCompile(`(?i)(token|passw|secret|api_?key|credential|authorization|private_?key|access_?key)`)
+
+// "name": "value" pairs in JSON and name=value pairs in forms
+var (
+    jsonField = regexp.MustCompile(`"([^"]+)"(\s*:\s*)"((?:[^"\\]|\\.)*)"`)
+    formField = regexp.MustCompile(`(^|&)([^=&]+)=([^&]*)`)
+)
+
+// RedactURL hides the password of the user info and the credential query parameters
+func RedactURL(u *url.URL) string {
+    if u == nil {
+        return ""
+    }
+    clean := *u
+    if clean.User != nil {
+        clean.User = url.User(redacted)
+    }
+    query := clean.Query()
+    changed := false
+    for name := range query {
+        if secretName.MatchString(name) {
+            query[name] = []string{redacted}
+            changed = true
+        }
+    }
+    if changed {
+        clean.RawQuery = query.Encode()
+    }
+    return clean.String()
+}
+
+// RedactHeaders copies the headers with the credentials hidden
+func RedactHeaders(headers http.Header) http.Header {
+    clean := headers.Clone()
+    for name := range clean {
+        if secretHeaders[http.CanonicalHeaderKey(name)] || secretName.MatchString(name) {
+            clean[name] = []string{redacted}
+        }
+    }
+    return clean
+}
+
+// RedactBody hides the values of credential-looking JSON and form fields
+func RedactBody(body string) string {
+    body = jsonField.ReplaceAllStringFunc(body, func(field string) string {
+        parts := jsonField.FindStringSubmatch(field)
+        if !secretName.MatchString(parts[1]) {
+            return field
+        }
+        return fmt.Sprintf(`"%s"%s"%s"`, parts[1], parts[2], redacted)
+    })
+    if !strings.ContainsAny(body, "{[") {
+        body = formField.ReplaceAllStringFunc(body, func(field string) string {
+            parts := formField.FindStringSubmatch(field)
+            if !secretName.MatchString(parts[2]) {
+                return field
+            }
+            return parts[1] + parts[2] + "=" + redacted
+        })
+    }
+    return body
+}
+
+// tracingTransport logs every round trip of the next transport and records it for the HAR file
+type tracingTransport struct {
+    next   http.RoundTripper
+    bodies bool
+    har    *harRecorder
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+    debug := slog.Default().Enabled(context.Background(), slog.LevelDebug)
+    if !debug && t.har == nil {
+        return t.next.RoundTrip(req)
+    }
+
+    var requestBody string
+    if t.bodies && req.Body != nil && req.Body != http.NoBody && textual(req.Header.Get("Content-Type")) {
+        data, err := ioutil.ReadAll(req.Body)
+        req.Body.Close()
+        if err != nil {
+            return nil, err
+        }
+        // The original request must not be changed, its body goes with a clone
+        req = req.Clone(req.Context())
+        req.Body = ioutil.NopCloser(bytes.NewReader(data))
+        requestBody = RedactBody(truncate(data))
+    }
+
+    started := time.Now()
+    resp, err := t.next.RoundTrip(req)
+    latency := time.Since(started)
+    target := RedactURL(req.URL)
+
+    if err != nil {
+        slog.Debug("HTTP request failed", "method", req.Method, "url", target, "latency", latency, "error", err)
+        t.har.add(req, requestBody, nil, "", started, latency, err)
+        return nil, err
+    }
+
+    var responseBody string
+    if t.bodies && textual(resp.Header.Get("Content-Type")) {
+        data, readErr := ioutil.ReadAll(io.LimitReader(resp.Body, maxTraceBody+1))
+        // The caller still reads the whole body, the part read here goes first
+        resp.Body = struct {
+            io.Reader
+            io.Closer
+        }{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+        if readErr == nil {
+            responseBody = RedactBody(truncate(data))
+        }
+    }
+
+    slog.Debug("HTTP request", "method", req.Method, "url", target, "status", resp.StatusCode, "latency", latency)
+    if t.bodies {
+        if requestBody != "" {
+            slog.Debug("HTTP request body", "method", req.Method, "url", target, "body", requestBody)
+        }
+        if responseBody != "" {
+            slog.Debug("HTTP response body", "method", req.Method, "url", target, "body", responseBody)
+        }
+    }
+    t.har.add(req, requestBody, resp, responseBody, started, latency, nil)
+    return resp, nil
+}
+
+// textual reports whether a body of the content type can be dumped
+func textual(contentType string) bool {
+    contentType = strings.ToLower(contentType)
+    for _, kind := range []string{"json", "text/", "xml", "x-www-form-urlencoded"} {
+        if strings.Contains(contentType, kind) {
+            return true
+        }
+    }
+    return false
+}
+
+func truncate(data []byte) string {
+    if len(data) > maxTraceBody {
+        return string(data[:maxTraceBody]) + fmt.Sprintf("... (cut at %d bytes)", maxTraceBody)
+    }
+    return string(data)
+}
+
+// HAR 1.2, only the parts support tools need
+
+type harLog struct {
+    Log harContent `json:"log"`
+}
+
+type harContent struct {
+    Version string     `json:"version"`
+    Creator harCreator `json:"creator"`
+    Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+    Name    string `json:"name"`
+    Version string `json:"version"`
+}
+
+type harEntry struct {
+    StartedDateTime time.Time   `json:"startedDateTime"`
+    Time            float64     `json:"time"`
+    Request         harRequest  `json:"request"`
+    Response        harResponse `json:"response"`
+    Cache           struct{}    `json:"cache"`
+    Timings         harTimings  `json:"timings"`
+    Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+    Method      string       `json:"method"`
+    URL         string       `json:"url"`
+    HTTPVersion string       `json:"httpVersion"`
+    Headers     []harPair    `json:"headers"`
+    QueryString []harPair    `json:"queryString"`
+    Cookies     []harPair    `json:"cookies"`
+    HeadersSize int          `json:"headersSize"`
+    BodySize    int64        `json:"bodySize"`
+    PostData    *harPostData `json:"postData,omitempty"`
+}
+
+type harPostData struct {
+    MimeType string `json:"mimeType"`
+    Text     string `json:"text"`
+}
+
+type harResponse struct {
+    Status      int       `json:"status"`
+    StatusText  string    `json:"statusText"`
+    HTTPVersion string    `json:"httpVersion"`
+    Headers     []harPair `json:"headers"`
+    Cookies     []harPair `json:"cookies"`
+    Content     harBody   `json:"content"`
+    RedirectURL string    `json:"redirectURL"`
+    HeadersSize int       `json:"headersSize"`
+    BodySize    int64     `json:"bodySize"`
+}
+
+type harBody struct {
+    Size     int64  `json:"size"`
+    MimeType string `json:"mimeType"`
+    Text     string `json:"text,omitempty"`
+}
+
+type harPair struct {
+    Name  string `json:"name"`
+    Value string `json:"value"`
+}
+
+type harTimings struct {
+    Send    float64 `json:"send"`
+    Wait    float64 `json:"wait"`
+    Receive float64 `json:"receive"`
+}
+
+// harRecorder keeps the entries and rewrites the file after every call,
+// so the file is complete even when the check exits early
+type harRecorder struct {
+    path string
+    mu   sync.Mutex
+    log  harLog
+}
+
+func newHARRecorder(path, version string) *harRecorder {
+    return &harRecorder{
+        path: path,
+        log:  harLog{Log: harContent{Version: "1.2", Creator: harCreator{Name: "SonarCheck", Version: version}, Entries: []harEntry{}}},
+    }
+}
+
+func (h *harRecorder) add(req *http.Request, requestBody string, resp *http.Response, responseBody string, started time.Time, latency time.Duration, err error) {
+    if h == nil {
+        return
+    }
+    ms := float64(latency.Microseconds()) / 1000
+    entry := harEntry{
+        StartedDateTime: started,
+        Time:            ms,
+        Request: harRequest{
+            Method:      req.Method,
+            URL:         RedactURL(req.URL),
+            HTTPVersion: req.Proto,
+            Headers:     harHeaders(req.Header),
+            QueryString: []harPair{},
+            Cookies:     []harPair{},
+            HeadersSize: -1,
+            BodySize:    req.ContentLength,
+        },
+        Response: harResponse{
+            Headers:     []harPair{},
+            Cookies:     []harPair{},
+            HeadersSize: -1,
+            BodySize:    -1,
+        },
+        Timings: harTimings{Send: 0, Wait: ms, Receive: 0},
+    }
+    if entry.Request.HTTPVersion == "" {
+        entry.Request.HTTPVersion = "HTTP/1.1"
+    }
+    if redactedURL, parseErr := url.Parse(entry.Request.URL); parseErr == nil {
+        for name, values := range redactedURL.Query() {
+            for _, value := range values {
+                entry.Request.QueryString = append(entry.Request.QueryString, harPair{name, value})
+            }
+        }
+    }
+    if requestBody != "" {
+        entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: requestBody}
+    }
+    if err != nil {
+        entry.Error = err.Error()
+    }
+    if resp != nil {
+        entry.Response.Status = resp.StatusCode
+        entry.Response.StatusText = http.StatusText(resp.StatusCode)
+        entry.Response.HTTPVersion = resp.Proto
+        entry.Response.Headers = harHeaders(resp.Header)
+        entry.Response.RedirectURL = resp.Header.Get("Location")
+        entry.Response.BodySize = resp.ContentLength
+        entry.Response.Content = harBody{Size: resp.ContentLength, MimeType: resp.Header.Get("Content-Type"), Text: responseBody}
+    }
+
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    h.log.Log.Entries = append(h.log.Log.Entries, entry)
+    data, marshalErr := json.MarshalIndent(h.log, "", "  ")
+    if marshalErr == nil {
+        marshalErr = ioutil.WriteFile(h.path, data, 0600)
+    }
+    if marshalErr != nil {
+        slog.Warn("Writing HAR file", "path", h.path, "error", marshalErr)
+    }
+}
+
+func harHeaders(headers http.Header) []harPair {
+    pairs := []harPair{}
+    for name, values := range RedactHeaders(headers) {
+        for _, value := range values {
+            pairs = append(pairs, harPair{name, value})
+        }
+    }
+    sort.Slice(pairs, func(i, j int) bool { return pairs[i].Name < pairs[j].Name })
+    return pairs
+}
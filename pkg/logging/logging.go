@@ -0,0 +1,44 @@
+package logging
+
+import (
+    "fmt"
+    "io"
+    "log/slog"
+    "strings"
+)
+
+// Formats of the log output
+const (
+    FormatText = "text"
+    FormatJSON = "json"
+)
+
+// Setup makes a logger with the level and format the default of slog, messages of the log package go through it too.
+// The level is debug, info, warn or error.
+func Setup(level, format string, w io.Writer) error {
+    var logLevel slog.Level
+    if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+        return fmt.Errorf("LOG_LEVEL must be debug, info, warn or error, got %q", level)
+    }
+    options := &slog.HandlerOptions{Level: logLevel}
+
+    var handler slog.Handler
+    switch strings.ToLower(format) {
+    case FormatText, "":
+        handler = slog.NewTextHandler(w, options)
+    case FormatJSON:
+        handler = slog.NewJSONHandler(w, options)
+    default:
+        return fmt.Errorf("LOG_FORMAT must be %s or %s, got %q", FormatText, FormatJSON, format)
+    }
+    slog.SetDefault(slog.New(handler))
+    return nil
+}
+
+// Component is the logger for messages about one component, with its name and version as attributes
+func Component(name, version string) *slog.Logger {
+    if version == "" {
+        return slog.With("component", name)
+    }
+    return slog.With("component", name, "version", version)
+}
@@ -0,0 +1,101 @@
+package policy
+
+import (
+    "fmt"
+    "strings"
+    "time"
+
+    "sonarcheck/pkg/logging"
+    "sonarcheck/pkg/sonarqube"
+    "sonarcheck/pkg/utils"
+)
+
+// Severity of a component result, the final decision is taken over these
+const (
+    SeverityOK      = "ok"
+    SeverityWarning = "warning"
+    SeverityError   = "error"
+    SeveritySkipped = "skipped"
+)
+
+// ComponentResult is the outcome of checking one component
+type ComponentResult struct {
+    Component  utils.Component
+    Version    string   // version that was checked, after overrides
+    Status     string   // sonarqube.GateStatus of the analysis, or Ignored, Waived, Library, External, NoVersion, NotFound, Error
+    ProjectKey string
+    ResolvedBy string   // how the project key was found, e.x. config override or component search
+    Analysis   sonarqube.Analysis
+    Labels     []string
+    Violations []string
+    Severity   string
+    Duration   time.Duration
+}
+
+// Policy decides how the analysis of a component counts, the zero value only accepts sonarqube.GateOK
+type Policy struct {
+    WarnOnly       bool          // violations are logged as warnings and don't fail the project
+    AllowWarn      bool          // the legacy sonarqube.GateWarn status counts as passed
+    StrictVersion  bool          // the analysis has to be of the exact version, not the nearest previous one
+    MaxAnalysisAge time.Duration // older analyses don't count, zero means any age
+    Branch         string        // branch the analysis has to be on, empty means the main branch
+    Labels         []string      // tags the decision rules can refer to, e.x. critical or experimental
+}
+
+// Violations lists why the analysis doesn't satisfy the policy, nothing when it does
+func (p Policy) Violations(version string, analysis sonarqube.Analysis, now time.Time) []string {
+    var violations []string
+    switch {
+    case analysis.Status == sonarqube.GateOK:
+    case analysis.Status == sonarqube.GateWarn && p.AllowWarn:
+    case analysis.Status == sonarqube.GateWarn:
+        violations = append(violations, "WARN not allowed")
+    case analysis.Status == sonarqube.GateError:
+        violations = append(violations, "quality gate failed")
+    default:
+        violations = append(violations, "no quality gate status")
+    }
+    if p.StrictVersion && analysis.Version != "" && strings.TrimSpace(analysis.Version) != strings.TrimSpace(version) {
+        violations = append(violations, fmt.Sprintf("analysis is of version %s", analysis.Version))
+    }
+    // Without a date the age can't be proven, that fails like a too old analysis
+    if p.MaxAnalysisAge > 0 && analysis.Date.IsZero() {
+        violations = append(violations, "analysis date unknown")
+    } else if p.MaxAnalysisAge > 0 && now.Sub(analysis.Date) > p.MaxAnalysisAge {
+        violations = append(violations, fmt.Sprintf("analysis is from %s, older than %s", analysis.Date.Format("2006-01-02"), p.MaxAnalysisAge))
+    }
+    if p.Branch != "" && analysis.Branch != p.Branch {
+        violations = append(violations, fmt.Sprintf("branch %s not analysed", p.Branch))
+    }
+    return violations
+}
+
+// Log the status of each component judged by its policy, returns the severity and the policy violations.
+// Without a version there is no analysis, the component is reported as utils.StatusNoVersion.
+func LogStatus(dependency, version string, analysis sonarqube.Analysis, policy Policy) (string, []string) {
+    logger := logging.Component(dependency, version)
+    status := string(analysis.Status)
+    if version == "" {
+        status = utils.StatusNoVersion
+        violations := []string{"no version found in chart"}
+        if policy.WarnOnly {
+            logger.Warn("No version found in chart, warn only", "status", status)
+            return SeverityWarning, violations
+        }
+        logger.Error("No version found in chart", "status", status)
+        return SeverityError, violations
+    }
+
+    violations := policy.Violations(version, analysis, time.Now())
+    switch {
+    case len(violations) == 0:
+        logger.Debug("Passed", "status", status)
+        return SeverityOK, nil
+    case policy.WarnOnly:
+        logger.Warn("Policy violated, warn only", "status", status, "violations", strings.Join(violations, ", "))
+        return SeverityWarning, violations
+    default:
+        logger.Error("Policy violated", "status", status, "violations", strings.Join(violations, ", "))
+        return SeverityError, violations
+    }
+}
@@ -0,0 +1,46 @@
+package policy
+
+import (
+    "reflect"
+    "testing"
+    "time"
+
+    "sonarcheck/pkg/sonarqube"
+)
+
+func TestViolations(t *testing.T) {
+    now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+    analysis := sonarqube.Analysis{Status: sonarqube.GateOK, Version: "1.2.0", Date: now.AddDate(0, 0, -3), Branch: "release"}
+
+    tests := []struct {
+        name     string
+        policy   Policy
+        version  string
+        analysis sonarqube.Analysis
+        want     []string
+    }{
+        {"passed", Policy{}, "1.2.0", sonarqube.Analysis{Status: sonarqube.GateOK}, nil},
+        {"failed gate", Policy{}, "1.2.0", sonarqube.Analysis{Status: sonarqube.GateError}, []string{"quality gate failed"}},
+        {"warn", Policy{}, "1.2.0", sonarqube.Analysis{Status: sonarqube.GateWarn}, []string{"WARN not allowed"}},
+        {"warn allowed", Policy{AllowWarn: true}, "1.2.0", sonarqube.Analysis{Status: sonarqube.GateWarn}, nil},
+        {"no status", Policy{}, "1.2.0", sonarqube.Analysis{Status: sonarqube.GateNone}, []string{"no quality gate status"}},
+        {"strict same version", Policy{StrictVersion: true}, " 1.2.0", analysis, nil},
+        {"strict previous version", Policy{StrictVersion: true}, "1.2.1", analysis, []string{"analysis is of version 1.2.0"}},
+        // Semver-equal but not the same version string
+        {"strict not exact", Policy{StrictVersion: true}, "1.2", analysis, []string{"analysis is of version 1.2.0"}},
+        {"recent enough", Policy{MaxAnalysisAge: 72 * time.Hour}, "1.2.0", analysis, nil},
+        {"too old", Policy{MaxAnalysisAge: 48 * time.Hour}, "1.2.0", analysis, []string{"analysis is from 2026-10-15, older than 48h0m0s"}},
+        {"date unknown", Policy{MaxAnalysisAge: 72 * time.Hour}, "1.2.0", sonarqube.Analysis{Status: sonarqube.GateOK}, []string{"analysis date unknown"}},
+        {"date unknown any age", Policy{}, "1.2.0", sonarqube.Analysis{Status: sonarqube.GateOK}, nil},
+        {"branch analysed", Policy{Branch: "release"}, "1.2.0", analysis, nil},
+        {"branch not analysed", Policy{Branch: "release"}, "1.2.0", sonarqube.Analysis{Status: sonarqube.GateNone}, []string{"no quality gate status", "branch release not analysed"}},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            got := test.policy.Violations(test.version, test.analysis, now)
+            if !reflect.DeepEqual(got, test.want) {
+                t.Errorf("Violations = %q, want %q", got, test.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,601 @@
+package policy
+
+import (
+    "fmt"
+    "regexp"
+    "strconv"
+    "strings"
+    "unicode"
+)
+
+// A small expression language over the component results, e.x.
+//
+//   status == "ERROR" && "experimental" in labels
+//   count(severity == "error" && !("critical" in labels)) > 2
+//
+// Values are strings, numbers, booleans and lists of strings. Operators are || && ! == != < <= > >= in
+// and =~ (regex match). count(), any() and all() evaluate their argument for every component.
+
+// Expr is a parsed expression
+type Expr struct {
+    source string
+    root   node
+}
+
+// Parse parses an expression, the error points at the offending position
+func Parse(source string) (*Expr, error) {
+    tokens, err := tokenize(source)
+    if err != nil {
+        return nil, err
+    }
+    p := &parser{tokens: tokens}
+    root, err := p.parseOr()
+    if err != nil {
+        return nil, fmt.Errorf("%s: %v", source, err)
+    }
+    if t := p.peek(); t.kind != tokenEOF {
+        return nil, fmt.Errorf("%s: unexpected %q at %d", source, t.text, t.pos)
+    }
+    return &Expr{source: source, root: root}, nil
+}
+
+func (e *Expr) String() string {
+    return e.source
+}
+
+// Check resolves the identifiers against the field types and checks the operand types, so a typo fails before
+// anything is evaluated. Component expressions see the fields directly, the others only inside the aggregates.
+func (e *Expr) Check(fields map[string]valueType, component bool) error {
+    t, err := e.root.check(checker{fields: fields, component: component})
+    if err != nil {
+        return fmt.Errorf("%s: %v", e.source, err)
+    }
+    if t != typeBool {
+        return fmt.Errorf("%s: expected true or false, got a %s", e.source, t)
+    }
+    return nil
+}
+
+// scope is what identifiers and aggregates resolve against
+type scope struct {
+    component map[string]interface{}
+    all       []map[string]interface{}
+}
+
+// types, the values an expression can produce
+
+type valueType int
+
+const (
+    typeBool valueType = iota
+    typeNumber
+    typeString
+    typeList
+)
+
+func (t valueType) String() string {
+    return [...]string{"boolean", "number", "string", "list"}[t]
+}
+
+// checker is the static counterpart of scope
+type checker struct {
+    fields    map[string]valueType
+    component bool
+}
+
+// tokens
+
+type tokenKind int
+
+const (
+    tokenEOF tokenKind = iota
+    tokenIdent
+    tokenString
+    tokenNumber
+    tokenOperator
+)
+
+type token struct {
+    kind tokenKind
+    text string
+    pos  int
+}
+
+var operatorTokens = []string{"||", "&&", "==", "!=", "<=", ">=", "=~", "<", ">", "!", "(", ")", "[", "]", ","}
+
+func tokenize(source string) ([]token, error) {
+    var tokens []token
+    for i := 0; i < len(source); {
+        c := rune(source[i])
+        switch {
+        case unicode.IsSpace(c):
+            i++
+        case c == '"':
+            end := i + 1
+            for end < len(source) && source[end] != '"' {
+                if source[end] == '\\' {
+                    end++
+                }
+                end++
+            }
+            if end >= len(source) {
+                return nil, fmt.Errorf("%s: unterminated string at %d", source, i)
+            }
+            value, err := strconv.Unquote(source[i : end+1])
+            if err != nil {
+                return nil, fmt.Errorf("%s: invalid string at %d: %v", source, i, err)
+            }
+            tokens = append(tokens, token{tokenString, value, i})
+            i = end + 1
+        case unicode.IsDigit(c):
+            end := i
+            for end < len(source) && (unicode.IsDigit(rune(source[end])) || source[end] == '.') {
+                end++
+            }
+            tokens = append(tokens, token{tokenNumber, source[i:end], i})
+            i = end
+        case unicode.IsLetter(c) || c == '_':
+            end := i
+            for end < len(source) && (unicode.IsLetter(rune(source[end])) || unicode.IsDigit(rune(source[end])) || source[end] == '_') {
+                end++
+            }
+            tokens = append(tokens, token{tokenIdent, source[i:end], i})
+            i = end
+        default:
+            matched := false
+            for _, op := range operatorTokens {
+                if strings.HasPrefix(source[i:], op) {
+                    tokens = append(tokens, token{tokenOperator, op, i})
+                    i += len(op)
+                    matched = true
+                    break
+                }
+            }
+            if !matched {
+                return nil, fmt.Errorf("%s: unexpected %q at %d", source, c, i)
+            }
+        }
+    }
+    return append(tokens, token{tokenEOF, "end of expression", len(source)}), nil
+}
+
+// parser, one function per precedence level
+
+type parser struct {
+    tokens []token
+    pos    int
+}
+
+func (p *parser) peek() token {
+    return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+    t := p.tokens[p.pos]
+    if t.kind != tokenEOF {
+        p.pos++
+    }
+    return t
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+    if t := p.peek(); t.kind == kind && t.text == text {
+        p.pos++
+        return true
+    }
+    return false
+}
+
+func (p *parser) expect(text string) error {
+    if !p.accept(tokenOperator, text) {
+        t := p.peek()
+        return fmt.Errorf("expected %q at %d, got %q", text, t.pos, t.text)
+    }
+    return nil
+}
+
+func (p *parser) parseOr() (node, error) {
+    left, err := p.parseAnd()
+    if err != nil {
+        return nil, err
+    }
+    for p.accept(tokenOperator, "||") {
+        right, err := p.parseAnd()
+        if err != nil {
+            return nil, err
+        }
+        left = logicalNode{"||", left, right}
+    }
+    return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+    left, err := p.parseNot()
+    if err != nil {
+        return nil, err
+    }
+    for p.accept(tokenOperator, "&&") {
+        right, err := p.parseNot()
+        if err != nil {
+            return nil, err
+        }
+        left = logicalNode{"&&", left, right}
+    }
+    return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+    if p.accept(tokenOperator, "!") {
+        operand, err := p.parseNot()
+        if err != nil {
+            return nil, err
+        }
+        return notNode{operand}, nil
+    }
+    return p.parseComparison()
+}
+
+var comparisonOperators = map[string]bool{"==": true, "!=": true, "<": true, "<=": true, ">": true, ">=": true, "=~": true}
+
+func (p *parser) parseComparison() (node, error) {
+    left, err := p.parsePrimary()
+    if err != nil {
+        return nil, err
+    }
+    t := p.peek()
+    if (t.kind == tokenOperator && comparisonOperators[t.text]) || (t.kind == tokenIdent && t.text == "in") {
+        p.next()
+        right, err := p.parsePrimary()
+        if err != nil {
+            return nil, err
+        }
+        if t.text == "=~" {
+            pattern, ok := right.(literalNode)
+            if !ok {
+                return nil, fmt.Errorf("=~ needs a string pattern at %d", t.pos)
+            }
+            source, ok := pattern.value.(string)
+            if !ok {
+                return nil, fmt.Errorf("=~ needs a string pattern at %d", t.pos)
+            }
+            re, err := regexp.Compile("^" + source + "$")
+            if err != nil {
+                return nil, fmt.Errorf("compiling pattern %q: %v", source, err)
+            }
+            return matchNode{left, re}, nil
+        }
+        return comparisonNode{t.text, left, right}, nil
+    }
+    return left, nil
+}
+
+func (p *parser) parsePrimary() (node, error) {
+    t := p.next()
+    switch t.kind {
+    case tokenString:
+        return literalNode{t.text}, nil
+    case tokenNumber:
+        number, err := strconv.ParseFloat(t.text, 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid number %q at %d", t.text, t.pos)
+        }
+        return literalNode{number}, nil
+    case tokenIdent:
+        switch t.text {
+        case "true":
+            return literalNode{true}, nil
+        case "false":
+            return literalNode{false}, nil
+        }
+        if !p.accept(tokenOperator, "(") {
+            return identNode{t.text}, nil
+        }
+        if _, ok := aggregates[t.text]; !ok {
+            return nil, fmt.Errorf("unknown function %s at %d", t.text, t.pos)
+        }
+        argument, err := p.parseOr()
+        if err != nil {
+            return nil, err
+        }
+        if err := p.expect(")"); err != nil {
+            return nil, err
+        }
+        return aggregateNode{t.text, argument}, nil
+    case tokenOperator:
+        switch t.text {
+        case "(":
+            inner, err := p.parseOr()
+            if err != nil {
+                return nil, err
+            }
+            return inner, p.expect(")")
+        case "[":
+            var list []string
+            for !p.accept(tokenOperator, "]") {
+                if len(list) > 0 {
+                    if err := p.expect(","); err != nil {
+                        return nil, err
+                    }
+                }
+                item := p.next()
+                if item.kind != tokenString {
+                    return nil, fmt.Errorf("lists hold strings only, got %q at %d", item.text, item.pos)
+                }
+                list = append(list, item.text)
+            }
+            return literalNode{list}, nil
+        }
+    }
+    return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// nodes
+
+type node interface {
+    eval(s *scope) (interface{}, error)
+    check(c checker) (valueType, error)
+}
+
+type literalNode struct {
+    value interface{}
+}
+
+func (n literalNode) eval(s *scope) (interface{}, error) {
+    return n.value, nil
+}
+
+func (n literalNode) check(c checker) (valueType, error) {
+    switch n.value.(type) {
+    case bool:
+        return typeBool, nil
+    case float64:
+        return typeNumber, nil
+    case string:
+        return typeString, nil
+    }
+    return typeList, nil
+}
+
+type identNode struct {
+    name string
+}
+
+func (n identNode) eval(s *scope) (interface{}, error) {
+    if s.component == nil {
+        return nil, fmt.Errorf("%s is a component field, use it inside count(), any() or all()", n.name)
+    }
+    value, ok := s.component[n.name]
+    if !ok {
+        return nil, fmt.Errorf("unknown field %s", n.name)
+    }
+    return value, nil
+}
+
+func (n identNode) check(c checker) (valueType, error) {
+    t, ok := c.fields[n.name]
+    if !ok {
+        return 0, fmt.Errorf("unknown field %s", n.name)
+    }
+    if !c.component {
+        return 0, fmt.Errorf("%s is a component field, use it inside count(), any() or all()", n.name)
+    }
+    return t, nil
+}
+
+type notNode struct {
+    operand node
+}
+
+func (n notNode) eval(s *scope) (interface{}, error) {
+    value, err := evalBool(n.operand, s)
+    return !value, err
+}
+
+func (n notNode) check(c checker) (valueType, error) {
+    return typeBool, checkBool(n.operand, c, "!")
+}
+
+type logicalNode struct {
+    operator    string
+    left, right node
+}
+
+func (n logicalNode) eval(s *scope) (interface{}, error) {
+    left, err := evalBool(n.left, s)
+    if err != nil {
+        return nil, err
+    }
+    if (n.operator == "&&" && !left) || (n.operator == "||" && left) {
+        return left, nil
+    }
+    return evalBool(n.right, s)
+}
+
+func (n logicalNode) check(c checker) (valueType, error) {
+    if err := checkBool(n.left, c, n.operator); err != nil {
+        return 0, err
+    }
+    return typeBool, checkBool(n.right, c, n.operator)
+}
+
+type matchNode struct {
+    operand node
+    re      *regexp.Regexp
+}
+
+func (n matchNode) eval(s *scope) (interface{}, error) {
+    value, err := n.operand.eval(s)
+    if err != nil {
+        return nil, err
+    }
+    text, ok := value.(string)
+    if !ok {
+        return nil, fmt.Errorf("=~ needs a string, got %v", value)
+    }
+    return n.re.MatchString(text), nil
+}
+
+func (n matchNode) check(c checker) (valueType, error) {
+    t, err := n.operand.check(c)
+    if err != nil {
+        return 0, err
+    }
+    if t != typeString {
+        return 0, fmt.Errorf("=~ needs a string, got a %s", t)
+    }
+    return typeBool, nil
+}
+
+type comparisonNode struct {
+    operator    string
+    left, right node
+}
+
+func (n comparisonNode) eval(s *scope) (interface{}, error) {
+    left, err := n.left.eval(s)
+    if err != nil {
+        return nil, err
+    }
+    right, err := n.right.eval(s)
+    if err != nil {
+        return nil, err
+    }
+
+    if n.operator == "in" {
+        list, ok := right.([]string)
+        if !ok {
+            return nil, fmt.Errorf("in needs a list on the right, got %v", right)
+        }
+        for _, item := range list {
+            if item == fmt.Sprint(left) {
+                return true, nil
+            }
+        }
+        return false, nil
+    }
+
+    switch l := left.(type) {
+    case float64:
+        r, ok := right.(float64)
+        if !ok {
+            return nil, fmt.Errorf("cannot compare number %v with %v", l, right)
+        }
+        switch n.operator {
+        case "==":
+            return l == r, nil
+        case "!=":
+            return l != r, nil
+        case "<":
+            return l < r, nil
+        case "<=":
+            return l <= r, nil
+        case ">":
+            return l > r, nil
+        default:
+            return l >= r, nil
+        }
+    case string, bool:
+        if n.operator != "==" && n.operator != "!=" {
+            return nil, fmt.Errorf("%s only compares numbers, got %v", n.operator, left)
+        }
+        equal := left == right
+        if n.operator == "==" {
+            return equal, nil
+        }
+        return !equal, nil
+    }
+    return nil, fmt.Errorf("cannot compare %v with %s", left, n.operator)
+}
+
+func (n comparisonNode) check(c checker) (valueType, error) {
+    left, err := n.left.check(c)
+    if err != nil {
+        return 0, err
+    }
+    right, err := n.right.check(c)
+    if err != nil {
+        return 0, err
+    }
+
+    switch {
+    case n.operator == "in":
+        if right != typeList {
+            return 0, fmt.Errorf("in needs a list on the right, got a %s", right)
+        }
+        if left == typeList {
+            return 0, fmt.Errorf("in needs a string or number on the left, got a list")
+        }
+    case left == typeList || right == typeList:
+        return 0, fmt.Errorf("%s cannot compare lists, use in", n.operator)
+    case left != right:
+        return 0, fmt.Errorf("cannot compare a %s with a %s", left, right)
+    case left != typeNumber && n.operator != "==" && n.operator != "!=":
+        return 0, fmt.Errorf("%s only compares numbers, got a %s", n.operator, left)
+    }
+    return typeBool, nil
+}
+
+// aggregates evaluate their argument for every component and combine the results
+var aggregates = map[string]func(matches, total int) interface{}{
+    "count": func(matches, total int) interface{} { return float64(matches) },
+    "any":   func(matches, total int) interface{} { return matches > 0 },
+    "all":   func(matches, total int) interface{} { return matches == total },
+}
+
+type aggregateNode struct {
+    function string
+    argument node
+}
+
+func (n aggregateNode) eval(s *scope) (interface{}, error) {
+    if s.component != nil {
+        return nil, fmt.Errorf("%s() cannot be used inside a component rule", n.function)
+    }
+    matches := 0
+    for _, component := range s.all {
+        ok, err := evalBool(n.argument, &scope{component: component})
+        if err != nil {
+            return nil, err
+        }
+        if ok {
+            matches++
+        }
+    }
+    return aggregates[n.function](matches, len(s.all)), nil
+}
+
+func (n aggregateNode) check(c checker) (valueType, error) {
+    if c.component {
+        return 0, fmt.Errorf("%s() cannot be used inside a component rule", n.function)
+    }
+    if err := checkBool(n.argument, checker{fields: c.fields, component: true}, n.function+"()"); err != nil {
+        return 0, err
+    }
+    if n.function == "count" {
+        return typeNumber, nil
+    }
+    return typeBool, nil
+}
+
+func evalBool(n node, s *scope) (bool, error) {
+    value, err := n.eval(s)
+    if err != nil {
+        return false, err
+    }
+    b, ok := value.(bool)
+    if !ok {
+        return false, fmt.Errorf("expected true or false, got %v", value)
+    }
+    return b, nil
+}
+
+func checkBool(n node, c checker, operator string) error {
+    t, err := n.check(c)
+    if err != nil {
+        return err
+    }
+    if t != typeBool {
+        return fmt.Errorf("%s needs true or false, got a %s", operator, t)
+    }
+    return nil
+}
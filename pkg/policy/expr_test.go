@@ -0,0 +1,139 @@
+package policy
+
+import (
+    "strings"
+    "testing"
+)
+
+var testComponents = []map[string]interface{}{
+    {"name": "app-ok", "status": "OK", "severity": "ok", "age": 2.0, "labels": []string{"critical"}},
+    {"name": "app-fail", "status": "ERROR", "severity": "error", "age": 40.0, "labels": []string{}},
+    {"name": "legacy-app", "status": "WARN", "severity": "warning", "age": 10.0, "labels": []string{"experimental"}},
+}
+
+var testFields = map[string]valueType{"name": typeString, "status": typeString, "severity": typeString, "age": typeNumber, "labels": typeList}
+
+func TestComponentExpressions(t *testing.T) {
+    tests := []struct {
+        source string
+        want   []bool // for every test component
+    }{
+        {`status == "OK"`, []bool{true, false, false}},
+        {`status != "OK"`, []bool{false, true, true}},
+        {`age > 5 && age <= 10`, []bool{false, false, true}},
+        {`age < 5 || age >= 40`, []bool{true, true, false}},
+        // && binds tighter than ||, ! tighter than && but looser than the comparisons
+        {`status == "OK" || status == "WARN" && age > 20`, []bool{true, false, false}},
+        {`(status == "OK" || status == "WARN") && age > 5`, []bool{false, false, true}},
+        {`!status == "OK" && age < 40`, []bool{false, false, true}},
+        {`!(status == "OK") && !("experimental" in labels)`, []bool{false, true, false}},
+        {`"critical" in labels`, []bool{true, false, false}},
+        {`name in ["app-ok", "legacy-app"]`, []bool{true, false, true}},
+        {`name =~ "app-.*"`, []bool{true, true, false}},
+        {`name =~ "app"`, []bool{false, false, false}},
+        {`true`, []bool{true, true, true}},
+    }
+    for _, test := range tests {
+        t.Run(test.source, func(t *testing.T) {
+            expr, err := Parse(test.source)
+            if err == nil {
+                err = expr.Check(testFields, true)
+            }
+            if err != nil {
+                t.Fatalf("compiling: %v", err)
+            }
+            for i, component := range testComponents {
+                got, err := evalBool(expr.root, &scope{component: component})
+                if err != nil {
+                    t.Fatalf("%s: %v", component["name"], err)
+                }
+                if got != test.want[i] {
+                    t.Errorf("%s = %v, want %v", component["name"], got, test.want[i])
+                }
+            }
+        })
+    }
+}
+
+func TestAggregateExpressions(t *testing.T) {
+    tests := []struct {
+        source string
+        want   bool
+    }{
+        {`count(severity == "error") > 0`, true},
+        {`count(severity == "error") > 1`, false},
+        {`count(severity == "error") > 0 || count(severity == "warning") > 2`, true},
+        {`count(true) == 3`, true},
+        {`any(status == "WARN")`, true},
+        {`any(status == "NONE")`, false},
+        {`all(age < 50)`, true},
+        {`all("critical" in labels)`, false},
+        {`!all(status == "OK") && count(age > 5) == 2`, true},
+    }
+    for _, test := range tests {
+        t.Run(test.source, func(t *testing.T) {
+            expr, err := Parse(test.source)
+            if err == nil {
+                err = expr.Check(testFields, false)
+            }
+            if err != nil {
+                t.Fatalf("compiling: %v", err)
+            }
+            got, err := evalBool(expr.root, &scope{all: testComponents})
+            if err != nil {
+                t.Fatal(err)
+            }
+            if got != test.want {
+                t.Errorf("got %v, want %v", got, test.want)
+            }
+        })
+    }
+}
+
+func TestExpressionErrors(t *testing.T) {
+    tests := []struct {
+        source    string
+        component bool
+        want      string
+    }{
+        // Parse errors
+        {`status ==`, true, `unexpected "end of expression" at 9`},
+        {`status == "OK`, true, "unterminated string at 10"},
+        {`(status == "OK"`, true, `expected ")" at 15`},
+        {`status = "OK"`, true, `unexpected '=' at 7`},
+        {`sum(age) > 1`, false, "unknown function sum at 0"},
+        {`name =~ status`, true, "=~ needs a string pattern at 5"},
+        {`name =~ "("`, true, "compiling pattern"},
+        {`name in [1]`, true, `lists hold strings only, got "1" at 9`},
+        // Check errors
+        {`count(x) > 0`, false, "unknown field x"},
+        {`count(severty == "error") > 0`, false, "unknown field severty"},
+        {`severity == "error"`, false, "severity is a component field, use it inside count(), any() or all()"},
+        {`count(severity == "error") > 0 || status == "ERROR"`, false, "status is a component field"},
+        {`count(severity == "error") > 0`, true, "count() cannot be used inside a component rule"},
+        {`count(severity == "error")`, false, "expected true or false, got a number"},
+        {`count(severity) > 0`, false, "count() needs true or false, got a string"},
+        {`status < "OK"`, true, "< only compares numbers, got a string"},
+        {`age > "10"`, true, "cannot compare a number with a string"},
+        {`status == 1`, true, "cannot compare a string with a number"},
+        {`labels == "critical"`, true, "== cannot compare lists, use in"},
+        {`"critical" in name`, true, "in needs a list on the right, got a string"},
+        {`age =~ "1.*"`, true, "=~ needs a string, got a number"},
+        {`!age`, true, "! needs true or false, got a number"},
+        {`age && true`, true, "&& needs true or false, got a number"},
+    }
+    for _, test := range tests {
+        t.Run(test.source, func(t *testing.T) {
+            expr, err := Parse(test.source)
+            if err == nil {
+                err = expr.Check(testFields, test.component)
+            }
+            if err == nil {
+                t.Fatalf("expected an error containing %q", test.want)
+            }
+            if !strings.Contains(err.Error(), test.want) || !strings.HasPrefix(err.Error(), test.source+": ") {
+                t.Errorf("error %q, want %q prefixed with the expression", err, test.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,140 @@
+package policy
+
+import (
+    "fmt"
+    "time"
+)
+
+// DefaultFail fails the check as soon as one component has the error severity
+const DefaultFail = `count(severity == "error") > 0`
+
+// SeverityRule sets the severity of the components the expression is true for
+type SeverityRule struct {
+    When     string `yaml:"when"`
+    Severity string `yaml:"severity"`
+
+    expr *Expr
+}
+
+// Decision turns the component results into the overall result. The severity rules are tried in order for
+// every component, the first one that is true wins. Then the fail expression decides over all components.
+type Decision struct {
+    Severity []SeverityRule `yaml:"severity,omitempty"`
+    Fail     string         `yaml:"fail,omitempty"`
+
+    fail *Expr
+}
+
+var severities = map[string]bool{
+    SeverityOK:      true,
+    SeverityWarning: true,
+    SeverityError:   true,
+    SeveritySkipped: true,
+}
+
+// Compile parses every expression, an empty fail expression means DefaultFail
+func (d *Decision) Compile() error {
+    for i := range d.Severity {
+        rule := &d.Severity[i]
+        if !severities[rule.Severity] {
+            return fmt.Errorf("severity rule %d: severity must be ok, warning, error or skipped, got %q", i+1, rule.Severity)
+        }
+        expr, err := Parse(rule.When)
+        if err == nil {
+            err = expr.Check(fieldTypes, true)
+        }
+        if err != nil {
+            return fmt.Errorf("severity rule %d: %v", i+1, err)
+        }
+        rule.expr = expr
+    }
+
+    source := d.Fail
+    if source == "" {
+        source = DefaultFail
+    }
+    fail, err := Parse(source)
+    if err == nil {
+        err = fail.Check(fieldTypes, false)
+    }
+    if err != nil {
+        return fmt.Errorf("fail expression: %v", err)
+    }
+    d.fail = fail
+    return nil
+}
+
+// Apply sets the severity of every result through the rules and reports whether the check failed
+func (d *Decision) Apply(results []ComponentResult, now time.Time) (bool, error) {
+    if d.fail == nil {
+        if err := d.Compile(); err != nil {
+            return false, err
+        }
+    }
+
+    fields := make([]map[string]interface{}, len(results))
+    for i := range results {
+        fields[i] = Fields(results[i], now)
+        for _, rule := range d.Severity {
+            ok, err := evalBool(rule.expr.root, &scope{component: fields[i]})
+            if err != nil {
+                return false, fmt.Errorf("severity rule %q for %s: %v", rule.When, results[i].Component.Name, err)
+            }
+            if ok {
+                results[i].Severity = rule.Severity
+                fields[i]["severity"] = rule.Severity
+                break
+            }
+        }
+    }
+
+    failed, err := evalBool(d.fail.root, &scope{all: fields})
+    if err != nil {
+        return false, fmt.Errorf("fail expression %q: %v", d.fail, err)
+    }
+    return failed, nil
+}
+
+// Fields are what a component expression can refer to. The age is in days, -1 without an analysis.
+func Fields(result ComponentResult, now time.Time) map[string]interface{} {
+    age := -1.0
+    if !result.Analysis.Date.IsZero() {
+        age = now.Sub(result.Analysis.Date).Hours() / 24
+    }
+    return map[string]interface{}{
+        "name":       result.Component.Name,
+        "path":       result.Component.Path,
+        "version":    result.Version,
+        "status":     result.Status,
+        "severity":   result.Severity,
+        "projectKey": result.ProjectKey,
+        "branch":     result.Analysis.Branch,
+        "age":        age,
+        "labels":     nonNil(result.Labels),
+        "conditions": nonNil(result.Analysis.FailedConditions()),
+        "violations": nonNil(result.Violations),
+    }
+}
+
+// fieldTypes are the types of the Fields, expressions are checked against them when they are compiled
+var fieldTypes = map[string]valueType{
+    "name":       typeString,
+    "path":       typeString,
+    "version":    typeString,
+    "status":     typeString,
+    "severity":   typeString,
+    "projectKey": typeString,
+    "branch":     typeString,
+    "age":        typeNumber,
+    "labels":     typeList,
+    "conditions": typeList,
+    "violations": typeList,
+}
+
+// Empty lists still have to be lists for the in operator
+func nonNil(list []string) []string {
+    if list == nil {
+        return []string{}
+    }
+    return list
+}
@@ -0,0 +1,73 @@
+package policy
+
+import (
+    "strings"
+    "testing"
+    "time"
+
+    "sonarcheck/pkg/sonarqube"
+    "sonarcheck/pkg/utils"
+)
+
+func TestDecisionCompile(t *testing.T) {
+    tests := []struct {
+        name     string
+        decision Decision
+        want     string
+    }{
+        {"default", Decision{}, ""},
+        {"readme", Decision{
+            Severity: []SeverityRule{
+                {When: `"experimental" in labels`, Severity: SeveritySkipped},
+                {When: `status == "ERROR" && !("critical" in labels)`, Severity: SeverityWarning},
+            },
+            Fail: `count(severity == "error") > 0 || count(severity == "warning") > 2`,
+        }, ""},
+        {"unknown severity", Decision{Severity: []SeverityRule{{When: "true", Severity: "fatal"}}}, `severity rule 1: severity must be ok, warning, error or skipped, got "fatal"`},
+        {"aggregate in severity rule", Decision{Severity: []SeverityRule{{When: `any(age > 30)`, Severity: SeverityError}}}, "severity rule 1: any(age > 30): any() cannot be used inside a component rule"},
+        {"typo in severity rule", Decision{Severity: []SeverityRule{{When: `stauts == "OK"`, Severity: SeverityOK}}}, "severity rule 1: stauts == \"OK\": unknown field stauts"},
+        {"typo in fail", Decision{Fail: `count(x) > 0`}, "fail expression: count(x) > 0: unknown field x"},
+        {"bare field in fail", Decision{Fail: `severity == "error"`}, "fail expression: severity == \"error\": severity is a component field"},
+        {"text compared in fail", Decision{Fail: `any(version < "2.0")`}, "< only compares numbers, got a string"},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            err := test.decision.Compile()
+            if test.want == "" {
+                if err != nil {
+                    t.Errorf("Compile: %v", err)
+                }
+                return
+            }
+            if err == nil || !strings.Contains(err.Error(), test.want) {
+                t.Errorf("Compile = %v, want %q", err, test.want)
+            }
+        })
+    }
+}
+
+func TestDecisionApply(t *testing.T) {
+    now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+    results := []ComponentResult{
+        {Component: utils.Component{Name: "app-ok"}, Status: "OK", Severity: SeverityOK, Analysis: sonarqube.Analysis{Status: sonarqube.GateOK, Date: now.AddDate(0, 0, -1)}},
+        {Component: utils.Component{Name: "app-fail"}, Status: "ERROR", Severity: SeverityError, Labels: []string{"experimental"}},
+    }
+    decision := Decision{
+        Severity: []SeverityRule{{When: `"experimental" in labels`, Severity: SeverityWarning}},
+        Fail:     `count(severity == "error") > 0 || any(age > 30)`,
+    }
+    if err := decision.Compile(); err != nil {
+        t.Fatal(err)
+    }
+
+    failed, err := decision.Apply(results, now)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if failed {
+        t.Errorf("Apply failed the check, the only error was lowered to a warning")
+    }
+    if results[1].Severity != SeverityWarning {
+        t.Errorf("severity of app-fail = %s, want %s", results[1].Severity, SeverityWarning)
+    }
+}
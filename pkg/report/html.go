@@ -0,0 +1,163 @@
+package report
+
+import (
+    "bytes"
+    "fmt"
+    "html/template"
+    "io/ioutil"
+    "strings"
+    "time"
+)
+
+// A single HTML file to attach to a change ticket, the styles and the filter script are inline so it opens offline
+
+var htmlFuncs = template.FuncMap{
+    "date": func(t *time.Time) string {
+        if t == nil {
+            return ""
+        }
+        return t.Format("2006-01-02 15:04")
+    },
+    "time": func(t time.Time) string {
+        return t.Format("2006-01-02 15:04:05 MST")
+    },
+    "summary": Component.summary,
+    "join":    strings.Join,
+    "seconds": seconds,
+}
+
+var htmlTemplate = template.Must(template.New("report").Funcs(htmlFuncs).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>SonarCheck {{.Subject}}: {{.Status}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #24292f; }
+h1 { font-size: 1.5em; }
+h2 { font-size: 1.2em; margin-top: 2em; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #d0d7de; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f6f8fa; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 2px 16px; }
+dt { font-weight: bold; }
+dd { margin: 0; }
+code { font-size: 0.9em; }
+.status { font-weight: bold; text-transform: uppercase; }
+.passed, .ok { color: #1a7f37; }
+.failed, .error { color: #cf222e; }
+.warning { color: #9a6700; }
+.skipped { color: #57606a; }
+.conditions { margin: 0; padding-left: 1.2em; }
+.filters { margin: 1em 0; }
+.filters input { width: 20em; }
+</style>
+</head>
+<body>
+<h1>SonarCheck {{.Subject}}: <span class="status {{.Status}}">{{.Status}}</span></h1>
+
+<dl>
+{{- with .Chart}}
+<dt>Chart</dt><dd><code>{{.Registry}}/{{.Repository}}/{{.Name}}:{{.Version}}</code></dd>
+{{- if .Digest}}
+<dt>Digest</dt><dd><code>{{.Digest}}</code></dd>
+{{- end}}
+{{- end}}
+{{- with .Build}}
+<dt>Build</dt><dd>{{if .Name}}{{.Name}}/{{.Number}}{{else}}{{.File}}{{end}}</dd>
+{{- end}}
+<dt>SonarQube</dt><dd><a href="{{.SonarQube.URL}}">{{.SonarQube.URL}}</a>{{with .SonarQube.Version}} ({{.}}){{end}}</dd>
+<dt>Checked</dt><dd>{{time .Timings.Started}}, {{seconds .Timings.TotalMs}}s</dd>
+<dt>Tool</dt><dd>{{.Tool.Name}} {{.Tool.Version}}</dd>
+<dt>Components</dt><dd>{{.Summary.Total}}: {{.Summary.OK}} ok, {{.Summary.Warning}} warning, {{.Summary.Error}} error, {{.Summary.Skipped}} skipped</dd>
+</dl>
+
+<h2>Components</h2>
+<div class="filters">
+<input id="filter" type="search" placeholder="Filter by name, version, status or project">
+<select id="severity">
+<option value="">All severities</option>
+<option value="ok">ok</option>
+<option value="warning">warning</option>
+<option value="error">error</option>
+<option value="skipped">skipped</option>
+</select>
+</div>
+<table id="components">
+<thead>
+<tr><th>Component</th><th>Version</th><th>Severity</th><th>Status</th><th>SonarQube project</th><th>Analysis</th><th>Details</th></tr>
+</thead>
+<tbody>
+{{- $report := .}}
+{{- range .Components}}
+<tr data-severity="{{.Severity}}">
+<td>{{.Name}}{{with .Path}}<br><small><code>{{.}}</code></small>{{end}}</td>
+<td>{{.Version}}{{with .VersionSource}}<br><small>{{.}}</small>{{end}}</td>
+<td class="{{.Severity}}">{{.Severity}}</td>
+<td>{{.Status}}</td>
+<td>{{$link := $report.DashboardURL .}}{{if $link}}<a href="{{$link}}">{{.ProjectKey}}</a>{{else}}{{.ProjectKey}}{{end}}{{with .ResolvedBy}}<br><small>{{.}}</small>{{end}}</td>
+<td>{{with .Analysis}}{{.Version}} {{date .Date}}{{with .Branch}}<br><small>branch {{.}}</small>{{end}}{{end}}</td>
+<td>
+{{- if or .Waiver .Violations (eq .Status "NotFound")}}{{summary .}}{{end}}
+{{- with .FailedConditions}}
+<ul class="conditions">
+{{- range .}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- with .Labels}}<br><small>labels: {{join . ", "}}</small>{{end}}
+</td>
+</tr>
+{{- end}}
+</tbody>
+</table>
+
+<h2>Waivers</h2>
+{{- if .Waivers}}
+<table>
+<thead>
+<tr><th>Component</th><th>Version</th><th>Pattern</th><th>Reason</th><th>Owner</th><th>Ticket</th><th>Expires</th></tr>
+</thead>
+<tbody>
+{{- range .Waivers}}
+<tr><td>{{.Component}}</td><td>{{.Version}}</td><td><code>{{.Pattern}}</code> {{.Versions}}</td><td>{{.Reason}}</td><td>{{.Owner}}</td><td>{{.Ticket}}</td><td>{{.Expires}}</td></tr>
+{{- end}}
+</tbody>
+</table>
+{{- else}}
+<p>No waiver applied.</p>
+{{- end}}
+
+<script>
+(function () {
+  var filter = document.getElementById("filter");
+  var severity = document.getElementById("severity");
+  function apply() {
+    var text = filter.value.toLowerCase();
+    var rows = document.querySelectorAll("#components tbody tr");
+    for (var i = 0; i < rows.length; i++) {
+      var row = rows[i];
+      var visible = row.textContent.toLowerCase().indexOf(text) >= 0 &&
+        (severity.value === "" || row.getAttribute("data-severity") === severity.value);
+      row.style.display = visible ? "" : "none";
+    }
+  }
+  filter.addEventListener("input", apply);
+  severity.addEventListener("change", apply);
+})();
+</script>
+</body>
+</html>
+`))
+
+// WriteHTML writes the report as a single HTML file
+func (r *Report) WriteHTML(path string) error {
+    var buf bytes.Buffer
+    if err := htmlTemplate.Execute(&buf, r); err != nil {
+        return fmt.Errorf("rendering HTML report: %v", err)
+    }
+    if err := ioutil.WriteFile(path, buf.Bytes(), 0644); err != nil {
+        return fmt.Errorf("writing HTML report: %v", err)
+    }
+    return nil
+}
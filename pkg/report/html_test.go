@@ -0,0 +1,62 @@
+package report
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestWriteHTML(t *testing.T) {
+    r := testReport()
+    r.Components[0].Name = "app-<ok>"
+    path := filepath.Join(t.TempDir(), "report.html")
+    if err := r.WriteHTML(path); err != nil {
+        t.Fatalf("WriteHTML: %v", err)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    html := string(data)
+
+    for _, want := range []string{
+        "<title>SonarCheck sample-1.0.0: failed</title>",
+        `<span class="status failed">failed</span>`,
+        "<code>charts-registry/team/sample:1.0.0</code>",
+        "<dt>Checked</dt><dd>2026-10-18 12:00:00 UTC, 1.500s</dd>",
+        "5: 1 ok, 1 warning, 2 error, 1 skipped",
+        `<tr data-severity="error">`,
+        "app-fail<br><small><code>sample/charts/app-fail/Chart.yaml</code></small>",
+        `<a href="https://sonarqube.example.com/dashboard?branch=release&amp;id=com.example%3Aapp-fail">com.example:app-fail</a>`,
+        "2.0.0 2026-10-17 09:30<br><small>branch release</small>",
+        "<li>new_coverage is 41.5, fails when &lt; 80</li>",
+        "<small>labels: experimental</small>",
+        "<td>legacy-mock</td><td>1.0.0</td><td><code>legacy-.*</code> </td><td>mock of a retired service</td><td>team-a</td><td>OPS-12</td>",
+        // Values from charts and SonarQube are escaped
+        "app-&lt;ok&gt;",
+    } {
+        if !strings.Contains(html, want) {
+            t.Errorf("HTML lacks %q", want)
+        }
+    }
+    if strings.Contains(html, "app-<ok>") {
+        t.Errorf("HTML contains the unescaped component name")
+    }
+}
+
+func TestWriteHTMLWithoutWaivers(t *testing.T) {
+    r := testReport()
+    r.Waivers = []Waiver{}
+    path := filepath.Join(t.TempDir(), "report.html")
+    if err := r.WriteHTML(path); err != nil {
+        t.Fatalf("WriteHTML: %v", err)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !strings.Contains(string(data), "<p>No waiver applied.</p>") {
+        t.Errorf("HTML without waivers lacks the note")
+    }
+}
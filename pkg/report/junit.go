@@ -0,0 +1,180 @@
+package report
+
+import (
+    "encoding/xml"
+    "fmt"
+    "io/ioutil"
+    "strings"
+)
+
+// JUnit XML as read by Jenkins and GitLab: the umbrella chart is the test suite, every component a test case
+
+type junitSuites struct {
+    XMLName  xml.Name     `xml:"testsuites"`
+    Name     string       `xml:"name,attr"`
+    Tests    int          `xml:"tests,attr"`
+    Failures int          `xml:"failures,attr"`
+    Errors   int          `xml:"errors,attr"`
+    Skipped  int          `xml:"skipped,attr"`
+    Time     string       `xml:"time,attr"`
+    Suites   []junitSuite `xml:"testsuite"`
+}
+
+type junitSuite struct {
+    Name       string          `xml:"name,attr"`
+    Tests      int             `xml:"tests,attr"`
+    Failures   int             `xml:"failures,attr"`
+    Errors     int             `xml:"errors,attr"`
+    Skipped    int             `xml:"skipped,attr"`
+    Time       string          `xml:"time,attr"`
+    Timestamp  string          `xml:"timestamp,attr"`
+    Properties []junitProperty `xml:"properties>property,omitempty"`
+    Cases      []junitCase     `xml:"testcase"`
+}
+
+type junitProperty struct {
+    Name  string `xml:"name,attr"`
+    Value string `xml:"value,attr"`
+}
+
+type junitCase struct {
+    Name      string        `xml:"name,attr"`
+    Classname string        `xml:"classname,attr"`
+    Time      string        `xml:"time,attr"`
+    Failure   *junitMessage `xml:"failure,omitempty"`
+    Error     *junitMessage `xml:"error,omitempty"`
+    Skipped   *junitMessage `xml:"skipped,omitempty"`
+    SystemOut *junitMessage `xml:"system-out,omitempty"`
+}
+
+// The text is CDATA so the line breaks of the details survive
+type junitMessage struct {
+    Message string `xml:"message,attr,omitempty"`
+    Type    string `xml:"type,attr,omitempty"`
+    Text    string `xml:",cdata"`
+}
+
+// Subject is what was checked, e.x. "sample-1.0.0" or "build release/42"
+func (r *Report) Subject() string {
+    switch {
+    case r.Chart != nil:
+        return fmt.Sprintf("%s-%s", r.Chart.Name, r.Chart.Version)
+    case r.Build != nil && r.Build.Name != "":
+        return fmt.Sprintf("build %s/%s", r.Build.Name, r.Build.Number)
+    case r.Build != nil:
+        return r.Build.File
+    }
+    return "SonarCheck"
+}
+
+// WriteJUnit writes the report as JUnit XML. Failed gates and policy violations are failures, missing projects
+// and SonarQube errors are errors, components that weren't checked are skipped. Warnings pass with the details in system-out.
+// The severity decides, a missing project lowered to a warning by a policy or a decision rule passes like any warning.
+func (r *Report) WriteJUnit(path string) error {
+    suite := junitSuite{
+        Name:      r.Subject(),
+        Time:      seconds(r.Timings.TotalMs),
+        Timestamp: r.Timings.Started.Format("2006-01-02T15:04:05"),
+    }
+    if r.Chart != nil {
+        suite.Properties = append(suite.Properties,
+            junitProperty{"chart", fmt.Sprintf("%s/%s/%s:%s", r.Chart.Registry, r.Chart.Repository, r.Chart.Name, r.Chart.Version)},
+            junitProperty{"digest", r.Chart.Digest})
+    }
+    suite.Properties = append(suite.Properties, junitProperty{"status", r.Status})
+
+    for _, component := range r.Components {
+        testCase := junitCase{
+            Name:      component.Name,
+            Classname: suite.Name,
+            Time:      seconds(component.DurationMs),
+        }
+        details := component.details()
+        switch {
+        case component.Severity == "error" && (component.Status == "NotFound" || component.Status == "Error"):
+            testCase.Error = &junitMessage{Message: component.summary(), Type: component.Status, Text: details}
+            suite.Errors++
+        case component.Severity == "error":
+            testCase.Failure = &junitMessage{Message: component.summary(), Type: component.Status, Text: details}
+            suite.Failures++
+        case component.Severity == "skipped":
+            testCase.Skipped = &junitMessage{Message: component.summary()}
+            suite.Skipped++
+        default:
+            testCase.SystemOut = &junitMessage{Text: details}
+        }
+        suite.Cases = append(suite.Cases, testCase)
+    }
+    suite.Tests = len(suite.Cases)
+
+    suites := junitSuites{
+        Name:     "SonarCheck",
+        Tests:    suite.Tests,
+        Failures: suite.Failures,
+        Errors:   suite.Errors,
+        Skipped:  suite.Skipped,
+        Time:     suite.Time,
+        Suites:   []junitSuite{suite},
+    }
+    data, err := xml.MarshalIndent(suites, "", "  ")
+    if err != nil {
+        return fmt.Errorf("encoding JUnit report: %v", err)
+    }
+    data = append([]byte(xml.Header), append(data, '\n')...)
+    if err := ioutil.WriteFile(path, data, 0644); err != nil {
+        return fmt.Errorf("writing JUnit report: %v", err)
+    }
+    return nil
+}
+
+// summary is a one line description of the component result
+func (c Component) summary() string {
+    switch {
+    case c.Waiver != nil:
+        return fmt.Sprintf("Waived: %s", c.Waiver.Reason)
+    case c.Status == "NotFound":
+        return "No SonarQube project found"
+    case len(c.Violations) > 0:
+        return fmt.Sprintf("%s: %s", c.Status, strings.Join(c.Violations, ", "))
+    }
+    return c.Status
+}
+
+// details lists the version, project, analysis and failed conditions of the component, one per line
+func (c Component) details() string {
+    var lines []string
+    lines = append(lines, fmt.Sprintf("version: %s (%s)", c.Version, c.VersionSource))
+    if c.Path != "" {
+        lines = append(lines, "path: "+c.Path)
+    }
+    if c.ProjectKey != "" {
+        lines = append(lines, fmt.Sprintf("project: %s (%s)", c.ProjectKey, c.ResolvedBy))
+    }
+    if c.Analysis != nil {
+        analysis := fmt.Sprintf("analysis: %s of version %s", c.Analysis.Key, c.Analysis.Version)
+        if c.Analysis.Date != nil {
+            analysis += " from " + c.Analysis.Date.Format("2006-01-02 15:04")
+        }
+        lines = append(lines, analysis)
+    }
+    for _, condition := range c.FailedConditions {
+        lines = append(lines, "failed condition: "+condition.String())
+    }
+    return strings.Join(lines, "\n")
+}
+
+// Comparators of the SonarQube API, the condition fails when the actual value compares like this to the threshold
+var comparators = map[string]string{"LT": "<", "GT": ">", "EQ": "=", "NE": "!="}
+
+// String describes the condition, e.x. "new_coverage is 41.5, fails when < 80"
+func (c Condition) String() string {
+    comparator, ok := comparators[c.Comparator]
+    if !ok {
+        comparator = c.Comparator
+    }
+    return fmt.Sprintf("%s is %s, fails when %s %s", c.Metric, c.ActualValue, comparator, c.ErrorThreshold)
+}
+
+func seconds(ms int64) string {
+    return fmt.Sprintf("%.3f", float64(ms)/1000)
+}
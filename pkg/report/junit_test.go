@@ -0,0 +1,67 @@
+package report
+
+import (
+    "encoding/xml"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestWriteJUnit(t *testing.T) {
+    r := testReport()
+    path := filepath.Join(t.TempDir(), "report.xml")
+    if err := r.WriteJUnit(path); err != nil {
+        t.Fatalf("WriteJUnit: %v", err)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var suites junitSuites
+    if err := xml.Unmarshal(data, &suites); err != nil {
+        t.Fatalf("parsing %s: %v", data, err)
+    }
+
+    if suites.Tests != 5 || suites.Failures != 1 || suites.Errors != 1 || suites.Skipped != 1 {
+        t.Errorf("tests=%d failures=%d errors=%d skipped=%d, want 5, 1, 1 and 1", suites.Tests, suites.Failures, suites.Errors, suites.Skipped)
+    }
+    suite := suites.Suites[0]
+    if suite.Name != "sample-1.0.0" {
+        t.Errorf("suite name = %s, want sample-1.0.0", suite.Name)
+    }
+
+    // The severity decides the outcome, a missing project lowered to a warning passes
+    want := map[string]string{
+        "app-ok":           "passed",
+        "app-fail":         "failure",
+        "missing-app":      "error",
+        "experimental-app": "passed",
+        "legacy-mock":      "skipped",
+    }
+    for _, testCase := range suite.Cases {
+        got := "passed"
+        switch {
+        case testCase.Failure != nil:
+            got = "failure"
+        case testCase.Error != nil:
+            got = "error"
+        case testCase.Skipped != nil:
+            got = "skipped"
+        }
+        if got != want[testCase.Name] {
+            t.Errorf("%s is %s, want %s", testCase.Name, got, want[testCase.Name])
+        }
+    }
+
+    failure := suite.Cases[1].Failure
+    if failure.Message != "ERROR: quality gate failed" || failure.Type != "ERROR" {
+        t.Errorf("failure of app-fail = %q of type %q", failure.Message, failure.Type)
+    }
+    if want := "failed condition: new_coverage is 41.5, fails when < 80"; !strings.Contains(failure.Text, want) {
+        t.Errorf("failure details %q don't list %q", failure.Text, want)
+    }
+    if e := suite.Cases[2].Error; e.Message != "No SonarQube project found" || e.Type != "NotFound" {
+        t.Errorf("error of missing-app = %q of type %q", e.Message, e.Type)
+    }
+}
@@ -0,0 +1,117 @@
+package report
+
+import (
+    "fmt"
+    "os"
+    "strings"
+)
+
+// Markdown summary for merge request notes and $GITHUB_STEP_SUMMARY: a status table of the components,
+// the failed conditions in a collapsed section and the waivers that applied
+
+var severityIcons = map[string]string{
+    "ok":      ":white_check_mark:",
+    "warning": ":warning:",
+    "error":   ":x:",
+    "skipped": ":fast_forward:",
+}
+
+// WriteMarkdown appends the Markdown summary to the file, $GITHUB_STEP_SUMMARY is shared by all steps of a job
+func (r *Report) WriteMarkdown(path string) error {
+    file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+    if err != nil {
+        return fmt.Errorf("writing Markdown report: %v", err)
+    }
+    if _, err := file.WriteString(r.Markdown()); err != nil {
+        file.Close()
+        return fmt.Errorf("writing Markdown report: %v", err)
+    }
+    if err := file.Close(); err != nil {
+        return fmt.Errorf("writing Markdown report: %v", err)
+    }
+    return nil
+}
+
+// Markdown renders the summary
+func (r *Report) Markdown() string {
+    var b strings.Builder
+
+    icon := severityIcons["ok"]
+    if r.Status == "failed" {
+        icon = severityIcons["error"]
+    }
+    fmt.Fprintf(&b, "## %s SonarCheck %s: %s\n\n", icon, r.Subject(), r.Status)
+    if r.Chart != nil && r.Chart.Digest != "" {
+        fmt.Fprintf(&b, "Chart `%s/%s/%s:%s` (`%s`)  \n", r.Chart.Registry, r.Chart.Repository, r.Chart.Name, r.Chart.Version, r.Chart.Digest)
+    }
+    fmt.Fprintf(&b, "%d components: %d ok, %d warning, %d error, %d skipped\n\n",
+        r.Summary.Total, r.Summary.OK, r.Summary.Warning, r.Summary.Error, r.Summary.Skipped)
+
+    b.WriteString("| | Component | Version | Status | SonarQube project | Details |\n")
+    b.WriteString("|---|---|---|---|---|---|\n")
+    for _, component := range r.Components {
+        details := ""
+        if component.Waiver != nil || len(component.Violations) > 0 || component.Status == "NotFound" {
+            details = component.summary()
+        }
+        fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n",
+            severityIcons[component.Severity],
+            cell(component.Name),
+            cell(component.Version),
+            cell(component.Status),
+            r.dashboardLink(component),
+            cell(details))
+    }
+
+    var failing []Component
+    for _, component := range r.Components {
+        if len(component.FailedConditions) > 0 {
+            failing = append(failing, component)
+        }
+    }
+    if len(failing) > 0 {
+        b.WriteString("\n<details>\n<summary>Failed conditions</summary>\n\n")
+        b.WriteString("| Component | Metric | Actual | Fails when |\n")
+        b.WriteString("|---|---|---|---|\n")
+        for _, component := range failing {
+            for _, condition := range component.FailedConditions {
+                comparator, ok := comparators[condition.Comparator]
+                if !ok {
+                    comparator = condition.Comparator
+                }
+                fmt.Fprintf(&b, "| %s | `%s` | %s | %s %s |\n",
+                    cell(component.Name), condition.Metric, cell(condition.ActualValue), cell(comparator), cell(condition.ErrorThreshold))
+            }
+        }
+        b.WriteString("\n</details>\n")
+    }
+
+    if len(r.Waivers) > 0 {
+        b.WriteString("\n### Waivers\n\n")
+        b.WriteString("| Component | Version | Reason | Owner | Ticket | Expires |\n")
+        b.WriteString("|---|---|---|---|---|---|\n")
+        for _, w := range r.Waivers {
+            fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n",
+                cell(w.Component), cell(w.Version), cell(w.Reason), cell(w.Owner), cell(w.Ticket), cell(w.Expires))
+        }
+    }
+    return b.String()
+}
+
+// dashboardLink links the project key to its SonarQube dashboard
+func (r *Report) dashboardLink(c Component) string {
+    link := r.DashboardURL(c)
+    if link == "" {
+        return cell(c.ProjectKey)
+    }
+    if c.Analysis != nil && c.Analysis.Version != "" {
+        return fmt.Sprintf("[%s](%s) (analysis of %s)", cell(c.ProjectKey), link, cell(c.Analysis.Version))
+    }
+    return fmt.Sprintf("[%s](%s)", cell(c.ProjectKey), link)
+}
+
+// cell escapes a value for a table cell, pipes would end the cell and line breaks the row
+func cell(value string) string {
+    value = strings.ReplaceAll(value, "|", "\\|")
+    return strings.Join(strings.Fields(value), " ")
+}
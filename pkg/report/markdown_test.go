@@ -0,0 +1,53 @@
+package report
+
+import (
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+)
+
+func TestMarkdown(t *testing.T) {
+    markdown := testReport().Markdown()
+
+    for _, want := range []string{
+        "## :x: SonarCheck sample-1.0.0: failed\n",
+        "Chart `charts-registry/team/sample:1.0.0` (`sha256:abc`)",
+        "5 components: 1 ok, 1 warning, 2 error, 1 skipped\n",
+        "| :white_check_mark: | app-ok | 1.0.0 | OK | [com.example:app-ok](https://sonarqube.example.com/dashboard?id=com.example%3Aapp-ok) (analysis of 1.0.0) |  |\n",
+        "| :x: | app-fail | 2.0.0 | ERROR | [com.example:app-fail](https://sonarqube.example.com/dashboard?branch=release&id=com.example%3Aapp-fail) (analysis of 2.0.0) | ERROR: quality gate failed |\n",
+        "| :warning: | experimental-app | 0.1.0 | NotFound |  | No SonarQube project found |\n",
+        "| :fast_forward: | legacy-mock | 1.0.0 | Waived |  | Waived: mock of a retired service |\n",
+        "| app-fail | `new_coverage` | 41.5 | < 80 |\n",
+        "| legacy-mock | 1.0.0 | mock of a retired service | team-a | OPS-12 |  |\n",
+    } {
+        if !strings.Contains(markdown, want) {
+            t.Errorf("Markdown lacks %q:\n%s", want, markdown)
+        }
+    }
+}
+
+// The summary file of a job is shared by its steps, the report is appended
+func TestWriteMarkdownAppends(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "summary.md")
+    if err := os.WriteFile(path, []byte("# Build\n"), 0644); err != nil {
+        t.Fatal(err)
+    }
+    r := testReport()
+    if err := r.WriteMarkdown(path); err != nil {
+        t.Fatalf("WriteMarkdown: %v", err)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(data) != "# Build\n"+r.Markdown() {
+        t.Errorf("summary file = %s", data)
+    }
+}
+
+func TestCell(t *testing.T) {
+    if got := cell("a|b\n  c"); got != `a\|b c` {
+        t.Errorf("cell = %q", got)
+    }
+}
@@ -0,0 +1,217 @@
+package report
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "net/url"
+    "strings"
+    "time"
+
+    "sonarcheck/pkg/policy"
+    "sonarcheck/pkg/sonarqube"
+    "sonarcheck/pkg/waiver"
+)
+
+// Schema of the report, bumped on every change that isn't backwards compatible
+const (
+    Schema        = "sonarcheck/report"
+    SchemaVersion = 1
+)
+
+// Report is the result of a check, every report format is written from it
+type Report struct {
+    Schema        string      `json:"schema"`
+    SchemaVersion int         `json:"schemaVersion"`
+    Tool          Tool        `json:"tool"`
+    Chart         *Chart      `json:"chart,omitempty"`
+    Build         *Build      `json:"build,omitempty"`
+    SonarQube     SonarQube   `json:"sonarqube"`
+    Status        string      `json:"status"`
+    Summary       Summary     `json:"summary"`
+    Timings       Timings     `json:"timings"`
+    Components    []Component `json:"components"`
+    Waivers       []Waiver    `json:"waivers"`
+}
+
+type Tool struct {
+    Name    string `json:"name"`
+    Version string `json:"version"`
+}
+
+// Chart are the coordinates of the umbrella chart in Artifactory
+type Chart struct {
+    Registry   string `json:"registry"`
+    Repository string `json:"repository"`
+    Name       string `json:"name"`
+    Version    string `json:"version"`
+    Digest     string `json:"digest,omitempty"`
+}
+
+// Build is the JFrog build the components were read from
+type Build struct {
+    Name   string `json:"name,omitempty"`
+    Number string `json:"number,omitempty"`
+    File   string `json:"file,omitempty"`
+}
+
+type SonarQube struct {
+    URL     string `json:"url"`
+    Version string `json:"version,omitempty"`
+}
+
+// Summary counts the components by severity
+type Summary struct {
+    Total   int `json:"total"`
+    OK      int `json:"ok"`
+    Warning int `json:"warning"`
+    Error   int `json:"error"`
+    Skipped int `json:"skipped"`
+}
+
+// Timings of the check, durations in milliseconds
+type Timings struct {
+    Started    time.Time `json:"started"`
+    Finished   time.Time `json:"finished"`
+    TotalMs    int64     `json:"totalMs"`
+    DiscoverMs int64     `json:"discoverMs"`
+    CheckMs    int64     `json:"checkMs"`
+}
+
+type Component struct {
+    Name             string      `json:"name"`
+    Path             string      `json:"path,omitempty"`
+    Version          string      `json:"version,omitempty"`
+    VersionSource    string      `json:"versionSource,omitempty"`
+    ProjectKey       string      `json:"projectKey,omitempty"`
+    ResolvedBy       string      `json:"resolvedBy,omitempty"`
+    Status           string      `json:"status"`
+    Severity         string      `json:"severity"`
+    Labels           []string    `json:"labels,omitempty"`
+    Violations       []string    `json:"violations,omitempty"`
+    Analysis         *Analysis   `json:"analysis,omitempty"`
+    FailedConditions []Condition `json:"failedConditions,omitempty"`
+    Waiver           *Waiver     `json:"waiver,omitempty"`
+    DurationMs       int64       `json:"durationMs"`
+}
+
+type Analysis struct {
+    Key        string               `json:"key,omitempty"`
+    Date       *time.Time           `json:"date,omitempty"`
+    Version    string               `json:"version,omitempty"`
+    Branch     string               `json:"branch,omitempty"`
+    GateStatus sonarqube.GateStatus `json:"gateStatus"`
+}
+
+type Condition struct {
+    Metric         string               `json:"metric"`
+    Status         sonarqube.GateStatus `json:"status"`
+    Comparator     string               `json:"comparator,omitempty"`
+    ErrorThreshold string               `json:"errorThreshold,omitempty"`
+    ActualValue    string               `json:"actualValue,omitempty"`
+}
+
+// Waiver is a waiver that excused a component, with the component it applied to
+type Waiver struct {
+    waiver.Waiver
+    Component string `json:"component"`
+    Version   string `json:"version,omitempty"`
+}
+
+// AddResults fills the components, waivers and summary of the report from the results of the check
+func (r *Report) AddResults(results []policy.ComponentResult, waivers map[string]*waiver.Waiver) {
+    r.Schema = Schema
+    r.SchemaVersion = SchemaVersion
+    r.Components = []Component{}
+    r.Waivers = []Waiver{}
+
+    for _, result := range results {
+        component := Component{
+            Name:          result.Component.Name,
+            Path:          result.Component.Path,
+            Version:       result.Version,
+            VersionSource: result.Component.VersionSource,
+            ProjectKey:    result.ProjectKey,
+            ResolvedBy:    result.ResolvedBy,
+            Status:        result.Status,
+            Severity:      result.Severity,
+            Labels:        result.Labels,
+            Violations:    result.Violations,
+            DurationMs:    result.Duration.Milliseconds(),
+        }
+        // Not the path in the working directory, the extracted layers are gone when the report is read
+        if chartPath := ChartPath(result.Component.Path); chartPath != "" {
+            component.Path = chartPath
+        }
+        if analysis := result.Analysis; analysis.Status != "" {
+            component.Analysis = &Analysis{
+                Key:        analysis.Key,
+                Version:    analysis.Version,
+                Branch:     analysis.Branch,
+                GateStatus: analysis.Status,
+            }
+            if !analysis.Date.IsZero() {
+                date := analysis.Date
+                component.Analysis.Date = &date
+            }
+            for _, condition := range analysis.Conditions {
+                if condition.Status != sonarqube.GateError && condition.Status != sonarqube.GateWarn {
+                    continue
+                }
+                component.FailedConditions = append(component.FailedConditions, Condition(condition))
+            }
+        }
+        if w := waivers[result.Component.Name]; w != nil && result.Status == "Waived" {
+            applied := Waiver{Waiver: *w, Component: result.Component.Name, Version: result.Version}
+            component.Waiver = &applied
+            r.Waivers = append(r.Waivers, applied)
+        }
+        r.Components = append(r.Components, component)
+
+        r.Summary.Total++
+        switch result.Severity {
+        case policy.SeverityOK:
+            r.Summary.OK++
+        case policy.SeverityWarning:
+            r.Summary.Warning++
+        case policy.SeverityError:
+            r.Summary.Error++
+        default:
+            r.Summary.Skipped++
+        }
+    }
+}
+
+// Finish records the overall status and the end of the check
+func (r *Report) Finish(failed bool) {
+    r.Status = "passed"
+    if failed {
+        r.Status = "failed"
+    }
+    r.Timings.Finished = time.Now()
+    r.Timings.TotalMs = r.Timings.Finished.Sub(r.Timings.Started).Milliseconds()
+}
+
+// DashboardURL is the SonarQube dashboard of the component's project, on the branch of the analysis if there is one
+func (r *Report) DashboardURL(c Component) string {
+    if r.SonarQube.URL == "" || c.ProjectKey == "" {
+        return ""
+    }
+    query := url.Values{"id": {c.ProjectKey}}
+    if c.Analysis != nil && c.Analysis.Branch != "" {
+        query.Set("branch", c.Analysis.Branch)
+    }
+    return fmt.Sprintf("%s/dashboard?%s", strings.TrimSuffix(r.SonarQube.URL, "/"), query.Encode())
+}
+
+// WriteJSON writes the report as indented JSON
+func (r *Report) WriteJSON(path string) error {
+    data, err := json.MarshalIndent(r, "", "  ")
+    if err != nil {
+        return fmt.Errorf("encoding JSON report: %v", err)
+    }
+    if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+        return fmt.Errorf("writing JSON report: %v", err)
+    }
+    return nil
+}
@@ -0,0 +1,152 @@
+package report
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "strings"
+    "testing"
+    "time"
+
+    "sonarcheck/pkg/policy"
+    "sonarcheck/pkg/sonarqube"
+    "sonarcheck/pkg/utils"
+    "sonarcheck/pkg/waiver"
+)
+
+// testReport is a finished check of an umbrella chart with a component of every kind
+func testReport() *Report {
+    started := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+    date := time.Date(2026, 10, 17, 9, 30, 0, 0, time.UTC)
+    legacyWaiver := Waiver{Waiver: waiver.Waiver{Pattern: "legacy-.*", Reason: "mock of a retired service", Owner: "team-a", Ticket: "OPS-12"},
+        Component: "legacy-mock", Version: "1.0.0"}
+    return &Report{
+        Schema:        Schema,
+        SchemaVersion: SchemaVersion,
+        Tool:          Tool{Name: "SonarCheck", Version: "1.2.3"},
+        Chart:         &Chart{Registry: "charts-registry", Repository: "team", Name: "sample", Version: "1.0.0", Digest: "sha256:abc"},
+        SonarQube:     SonarQube{URL: "https://sonarqube.example.com", Version: "10.4.1.88267"},
+        Status:        "failed",
+        Summary:       Summary{Total: 5, OK: 1, Warning: 1, Error: 2, Skipped: 1},
+        Timings:       Timings{Started: started, Finished: started.Add(1500 * time.Millisecond), TotalMs: 1500, DiscoverMs: 500, CheckMs: 1000},
+        Components: []Component{
+            {Name: "app-ok", Path: "sample/charts/app-ok/Chart.yaml", Version: "1.0.0", VersionSource: "appVersion", ProjectKey: "com.example:app-ok",
+                ResolvedBy: "component search", Status: "OK", Severity: "ok", DurationMs: 120,
+                Analysis: &Analysis{Key: "A1", Date: &date, Version: "1.0.0", GateStatus: "OK"}},
+            {Name: "app-fail", Path: "sample/charts/app-fail/Chart.yaml", Version: "2.0.0", VersionSource: "appVersion", ProjectKey: "com.example:app-fail",
+                ResolvedBy: "component search", Status: "ERROR", Severity: "error", Violations: []string{"quality gate failed"}, DurationMs: 200,
+                Analysis:         &Analysis{Key: "A2", Date: &date, Version: "2.0.0", Branch: "release", GateStatus: "ERROR"},
+                FailedConditions: []Condition{{Metric: "new_coverage", Status: "ERROR", Comparator: "LT", ErrorThreshold: "80", ActualValue: "41.5"}}},
+            {Name: "missing-app", Path: "sample/charts/missing-app/Chart.yaml", Version: "1.0.0", VersionSource: "version", Status: "NotFound", Severity: "error"},
+            {Name: "experimental-app", Path: "sample/charts/experimental-app/Chart.yaml", Version: "0.1.0", VersionSource: "version", Status: "NotFound", Severity: "warning",
+                Labels: []string{"experimental"}},
+            {Name: "legacy-mock", Path: "sample/charts/legacy-mock/Chart.yaml", Version: "1.0.0", VersionSource: "appVersion", Status: "Waived", Severity: "skipped",
+                Waiver: &legacyWaiver},
+        },
+        Waivers: []Waiver{legacyWaiver},
+    }
+}
+
+func TestAddResults(t *testing.T) {
+    w := &waiver.Waiver{Pattern: "legacy-.*", Reason: "mock of a retired service", Owner: "team-a"}
+    results := []policy.ComponentResult{
+        {Component: utils.Component{Name: "app", Path: "layer_1/sample/charts/app/Chart.yaml", VersionSource: "appVersion"},
+            Version: "1.0.0", Status: "OK", Severity: policy.SeverityOK, ProjectKey: "com.example:app", ResolvedBy: "component search",
+            Analysis: sonarqube.Analysis{Key: "A1", Status: sonarqube.GateOK, Version: "1.0.0"}},
+        {Component: utils.Component{Name: "legacy-mock", Path: "layer_2/sample/charts/legacy-mock/Chart.yaml"},
+            Version: "1.0.0", Status: "Waived", Severity: policy.SeveritySkipped},
+        // A component of a build-info has no Chart.yaml, its path is kept
+        {Component: utils.Component{Name: "lib", Path: "release/42#com.example:lib:2.0.0"},
+            Version: "2.0.0", Status: "ERROR", Severity: policy.SeverityError, Violations: []string{"quality gate failed"}},
+    }
+    r := &Report{}
+    r.AddResults(results, map[string]*waiver.Waiver{"legacy-mock": w})
+
+    wantPaths := []string{"sample/charts/app/Chart.yaml", "sample/charts/legacy-mock/Chart.yaml", "release/42#com.example:lib:2.0.0"}
+    for i, component := range r.Components {
+        if component.Path != wantPaths[i] {
+            t.Errorf("path of %s = %s, want %s", component.Name, component.Path, wantPaths[i])
+        }
+    }
+    if r.Summary != (Summary{Total: 3, OK: 1, Error: 1, Skipped: 1}) {
+        t.Errorf("summary = %+v", r.Summary)
+    }
+    if len(r.Waivers) != 1 || r.Waivers[0].Component != "legacy-mock" || r.Components[1].Waiver == nil {
+        t.Errorf("waivers = %+v, want the waiver of legacy-mock", r.Waivers)
+    }
+    if r.Components[0].Analysis == nil || r.Components[0].Analysis.Date != nil {
+        t.Errorf("analysis of app = %+v, want one without a date", r.Components[0].Analysis)
+    }
+}
+
+func TestWriteJSON(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "report.json")
+    if err := testReport().WriteJSON(path); err != nil {
+        t.Fatalf("WriteJSON: %v", err)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The field names are the schema the consumers rely on
+    var got struct {
+        Schema        string `json:"schema"`
+        SchemaVersion int    `json:"schemaVersion"`
+        Status        string `json:"status"`
+        Chart         struct {
+            Name   string `json:"name"`
+            Digest string `json:"digest"`
+        } `json:"chart"`
+        Summary    map[string]int `json:"summary"`
+        Components []struct {
+            Name     string `json:"name"`
+            Path     string `json:"path"`
+            Severity string `json:"severity"`
+            Analysis *struct {
+                Date       string `json:"date"`
+                GateStatus string `json:"gateStatus"`
+            } `json:"analysis"`
+            FailedConditions []map[string]string `json:"failedConditions"`
+            Waiver           *struct {
+                Reason    string `json:"reason"`
+                Component string `json:"component"`
+            } `json:"waiver"`
+        } `json:"components"`
+        Waivers []map[string]string `json:"waivers"`
+    }
+    if err := json.Unmarshal(data, &got); err != nil {
+        t.Fatalf("parsing %s: %v", data, err)
+    }
+    if got.Schema != Schema || got.SchemaVersion != SchemaVersion || got.Status != "failed" || got.Chart.Name != "sample" || got.Chart.Digest != "sha256:abc" {
+        t.Errorf("header = %s %d %s %+v", got.Schema, got.SchemaVersion, got.Status, got.Chart)
+    }
+    if got.Summary["total"] != 5 || got.Summary["error"] != 2 || got.Summary["skipped"] != 1 {
+        t.Errorf("summary = %v", got.Summary)
+    }
+    if len(got.Components) != 5 {
+        t.Fatalf("%d components, want 5", len(got.Components))
+    }
+    fail := got.Components[1]
+    if fail.Name != "app-fail" || fail.Path != "sample/charts/app-fail/Chart.yaml" || fail.Severity != "error" {
+        t.Errorf("app-fail = %+v", fail)
+    }
+    if fail.Analysis == nil || fail.Analysis.Date != "2026-10-17T09:30:00Z" || fail.Analysis.GateStatus != "ERROR" {
+        t.Errorf("analysis of app-fail = %+v", fail.Analysis)
+    }
+    if len(fail.FailedConditions) != 1 || fail.FailedConditions[0]["metric"] != "new_coverage" || fail.FailedConditions[0]["actualValue"] != "41.5" {
+        t.Errorf("failed conditions of app-fail = %v", fail.FailedConditions)
+    }
+    if waived := got.Components[4].Waiver; waived == nil || waived.Reason != "mock of a retired service" || waived.Component != "legacy-mock" {
+        t.Errorf("waiver of legacy-mock = %+v", waived)
+    }
+    if len(got.Waivers) != 1 || got.Waivers[0]["owner"] != "team-a" {
+        t.Errorf("waivers = %v", got.Waivers)
+    }
+    // No waiver is an empty list, not null
+    empty := testReport()
+    empty.Waivers = []Waiver{}
+    if data, _ := json.Marshal(empty); !strings.Contains(string(data), `"waivers":[]`) {
+        t.Errorf("report without waivers = %s", data)
+    }
+}
@@ -0,0 +1,195 @@
+package report
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/ioutil"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// SARIF 2.1.0 for code-scanning dashboards: every failed condition of a failing component is a result with the
+// metric key as rule id, components failing for other reasons get one result with a SonarCheck rule id
+
+const sarifSchema = "https://json.schemastore.org/sarif-2.1.0.json"
+
+// Rule ids of results without a failed condition
+const (
+    RuleProjectNotFound = "sonarcheck/project-not-found"
+    RuleSonarQubeError  = "sonarcheck/sonarqube-error"
+    RuleNoVersion       = "sonarcheck/no-version"
+    RuleQualityGate     = "sonarcheck/quality-gate"
+)
+
+var ruleDescriptions = map[string]string{
+    RuleProjectNotFound: "The component has no SonarQube project",
+    RuleSonarQubeError:  "SonarQube could not be queried for the component",
+    RuleNoVersion:       "No version was found for the component",
+    RuleQualityGate:     "The component doesn't pass the quality gate or its policy",
+}
+
+type sarifLog struct {
+    Schema  string     `json:"$schema"`
+    Version string     `json:"version"`
+    Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+    Tool       sarifTool              `json:"tool"`
+    Automation *sarifAutomation       `json:"automationDetails,omitempty"`
+    Results    []sarifResult          `json:"results"`
+    Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifTool struct {
+    Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+    Name    string      `json:"name"`
+    Version string      `json:"version,omitempty"`
+    Rules   []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+    ID               string       `json:"id"`
+    ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifAutomation struct {
+    ID string `json:"id"`
+}
+
+type sarifMessage struct {
+    Text string `json:"text"`
+}
+
+type sarifResult struct {
+    RuleID     string                 `json:"ruleId"`
+    Level      string                 `json:"level"`
+    Message    sarifMessage           `json:"message"`
+    Locations  []sarifLocation        `json:"locations,omitempty"`
+    Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+    Physical *sarifPhysicalLocation `json:"physicalLocation,omitempty"`
+    Logical  []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+    ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+    URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+    Name string `json:"name"`
+    Kind string `json:"kind"`
+}
+
+// WriteSARIF writes the failing components as a SARIF 2.1.0 log
+func (r *Report) WriteSARIF(path string) error {
+    run := sarifRun{
+        Tool:       sarifTool{Driver: sarifDriver{Name: r.Tool.Name, Version: r.Tool.Version}},
+        Automation: &sarifAutomation{ID: r.Subject()},
+        Results:    []sarifResult{},
+        Properties: map[string]interface{}{"status": r.Status, "sonarqube": r.SonarQube.URL},
+    }
+    if r.Chart != nil && r.Chart.Digest != "" {
+        run.Properties["digest"] = r.Chart.Digest
+    }
+
+    rules := make(map[string]string)
+    for _, component := range r.Components {
+        if component.Severity != "error" && component.Severity != "warning" {
+            continue
+        }
+        location := component.sarifLocation()
+        properties := map[string]interface{}{
+            "component": component.Name,
+            "version":   component.Version,
+            "status":    component.Status,
+        }
+        if component.ProjectKey != "" {
+            properties["projectKey"] = component.ProjectKey
+        }
+
+        for _, condition := range component.FailedConditions {
+            rules[condition.Metric] = fmt.Sprintf("Quality gate condition on %s", condition.Metric)
+            run.Results = append(run.Results, sarifResult{
+                RuleID:     condition.Metric,
+                Level:      component.Severity,
+                Message:    sarifMessage{fmt.Sprintf("%s-%s: %s", component.Name, component.Version, condition)},
+                Locations:  []sarifLocation{location},
+                Properties: properties,
+            })
+        }
+        if len(component.FailedConditions) > 0 {
+            continue
+        }
+
+        rule := RuleQualityGate
+        switch component.Status {
+        case "NotFound":
+            rule = RuleProjectNotFound
+        case "Error":
+            rule = RuleSonarQubeError
+        case "NoVersion":
+            rule = RuleNoVersion
+        }
+        rules[rule] = ruleDescriptions[rule]
+        run.Results = append(run.Results, sarifResult{
+            RuleID:     rule,
+            Level:      component.Severity,
+            Message:    sarifMessage{fmt.Sprintf("%s-%s: %s", component.Name, component.Version, component.summary())},
+            Locations:  []sarifLocation{location},
+            Properties: properties,
+        })
+    }
+
+    ids := make([]string, 0, len(rules))
+    for id := range rules {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+    run.Tool.Driver.Rules = []sarifRule{}
+    for _, id := range ids {
+        run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: id, ShortDescription: sarifMessage{rules[id]}})
+    }
+
+    data, err := json.MarshalIndent(sarifLog{Schema: sarifSchema, Version: "2.1.0", Runs: []sarifRun{run}}, "", "  ")
+    if err != nil {
+        return fmt.Errorf("encoding SARIF report: %v", err)
+    }
+    if err := ioutil.WriteFile(path, append(data, '\n'), 0644); err != nil {
+        return fmt.Errorf("writing SARIF report: %v", err)
+    }
+    return nil
+}
+
+// sarifLocation points at the Chart.yaml of the subchart inside the umbrella, components of a build
+// have no file so they only get a logical location
+func (c Component) sarifLocation() sarifLocation {
+    location := sarifLocation{Logical: []sarifLogicalLocation{{Name: c.Name, Kind: "module"}}}
+    if chartPath := ChartPath(c.Path); chartPath != "" {
+        location.Physical = &sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: chartPath}}
+    }
+    return location
+}
+
+// ChartPath turns the path of an extracted Chart.yaml into its path inside the umbrella chart,
+// e.x. layer_1/sample/charts/app/Chart.yaml becomes sample/charts/app/Chart.yaml
+func ChartPath(path string) string {
+    if filepath.Base(path) != "Chart.yaml" {
+        return ""
+    }
+    parts := strings.SplitN(filepath.ToSlash(path), "/", 2)
+    if len(parts) == 2 && strings.HasPrefix(parts[0], "layer_") {
+        return parts[1]
+    }
+    return filepath.ToSlash(path)
+}
@@ -0,0 +1,72 @@
+package report
+
+import (
+    "encoding/json"
+    "os"
+    "path/filepath"
+    "testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "report.sarif")
+    if err := testReport().WriteSARIF(path); err != nil {
+        t.Fatalf("WriteSARIF: %v", err)
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var log sarifLog
+    if err := json.Unmarshal(data, &log); err != nil {
+        t.Fatalf("parsing %s: %v", data, err)
+    }
+    if log.Version != "2.1.0" || len(log.Runs) != 1 {
+        t.Fatalf("version %s with %d runs, want 2.1.0 with one run", log.Version, len(log.Runs))
+    }
+    run := log.Runs[0]
+
+    // Passed and skipped components have no result, a failed condition is its own result
+    want := []struct {
+        ruleID string
+        level  string
+        uri    string
+    }{
+        {"new_coverage", "error", "sample/charts/app-fail/Chart.yaml"},
+        {RuleProjectNotFound, "error", "sample/charts/missing-app/Chart.yaml"},
+        {RuleProjectNotFound, "warning", "sample/charts/experimental-app/Chart.yaml"},
+    }
+    if len(run.Results) != len(want) {
+        t.Fatalf("%d results, want %d: %s", len(run.Results), len(want), data)
+    }
+    for i, result := range run.Results {
+        if result.RuleID != want[i].ruleID || result.Level != want[i].level {
+            t.Errorf("result %d = %s %s, want %s %s", i, result.RuleID, result.Level, want[i].ruleID, want[i].level)
+        }
+        if len(result.Locations) != 1 || result.Locations[0].Physical == nil || result.Locations[0].Physical.ArtifactLocation.URI != want[i].uri {
+            t.Errorf("location of result %d = %+v, want %s", i, result.Locations, want[i].uri)
+        }
+    }
+    if msg := run.Results[0].Message.Text; msg != "app-fail-2.0.0: new_coverage is 41.5, fails when < 80" {
+        t.Errorf("message = %s", msg)
+    }
+    if len(run.Tool.Driver.Rules) != 2 || run.Tool.Driver.Rules[0].ID != "new_coverage" || run.Tool.Driver.Rules[1].ID != RuleProjectNotFound {
+        t.Errorf("rules = %+v, want new_coverage and %s", run.Tool.Driver.Rules, RuleProjectNotFound)
+    }
+    if run.Automation == nil || run.Automation.ID != "sample-1.0.0" || run.Properties["digest"] != "sha256:abc" {
+        t.Errorf("automation %+v with properties %v", run.Automation, run.Properties)
+    }
+}
+
+func TestChartPath(t *testing.T) {
+    tests := map[string]string{
+        "layer_1/sample/charts/app/Chart.yaml": "sample/charts/app/Chart.yaml",
+        "sample/charts/app/Chart.yaml":         "sample/charts/app/Chart.yaml",
+        "release/42#com.example:lib:2.0.0":     "",
+        "":                                     "",
+    }
+    for path, want := range tests {
+        if got := ChartPath(path); got != want {
+            t.Errorf("ChartPath(%q) = %q, want %q", path, got, want)
+        }
+    }
+}
@@ -0,0 +1,72 @@
+package sonarqube
+
+import (
+    "strings"
+    "time"
+)
+
+// GateStatus is the quality gate status code of the SonarQube API, it doesn't depend on the locale
+type GateStatus string
+
+const (
+    GateOK    GateStatus = "OK"
+    GateWarn  GateStatus = "WARN"
+    GateError GateStatus = "ERROR"
+    GateNone  GateStatus = "NONE"
+)
+
+// ParseGateStatus maps an API status code onto a GateStatus, anything unknown is GateNone
+func ParseGateStatus(code string) GateStatus {
+    switch status := GateStatus(strings.ToUpper(strings.TrimSpace(code))); status {
+    case GateOK, GateWarn, GateError:
+        return status
+    }
+    return GateNone
+}
+
+// GateStatusFromEventName is the fallback for quality gate events without a status code. Event names are
+// "Passed", "Warn" and "Failed" on recent versions, colors on older ones, e.x. "Green (was Red)".
+func GateStatusFromEventName(name string) GateStatus {
+    if i := strings.Index(name, " (was "); i >= 0 {
+        name = name[:i]
+    }
+    switch strings.ToLower(strings.TrimSpace(name)) {
+    case "passed", "green", "ok":
+        return GateOK
+    case "warn", "orange", "warning":
+        return GateWarn
+    case "failed", "red", "error":
+        return GateError
+    }
+    return GateNone
+}
+
+// Analysis is the SonarQube analysis a component version is judged by
+type Analysis struct {
+    Key        string
+    Status     GateStatus
+    Version    string
+    Date       time.Time
+    Branch     string
+    Conditions []Condition
+}
+
+// Condition is one quality gate condition of an analysis
+type Condition struct {
+    Metric         string
+    Status         GateStatus
+    Comparator     string
+    ErrorThreshold string
+    ActualValue    string
+}
+
+// FailedConditions returns the metric keys of the conditions that didn't pass
+func (a Analysis) FailedConditions() []string {
+    var metrics []string
+    for _, condition := range a.Conditions {
+        if condition.Status == GateError || condition.Status == GateWarn {
+            metrics = append(metrics, condition.Metric)
+        }
+    }
+    return metrics
+}
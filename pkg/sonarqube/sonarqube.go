@@ -2,45 +2,217 @@ package sonarqube
 
 import (
     "encoding/json"
+    "errors"
     "fmt"
     "io/ioutil"
+    "log/slog"
     "net/http"
+    neturl "net/url"
+    "strconv"
+    "strings"
+    "time"
 
+    "sonarcheck/pkg/httpclient"
     "sonarcheck/pkg/utils"
 )
 
-func CheckAvailability(sonarqubeURL, sonarqubeToken string) error {
+// Server is a SonarQube instance with the detected version and the auth scheme that goes with it
+type Server struct {
+    URL        string
+    Token      string
+    Version    string
+    AuthScheme string
+    major      int
+    minor      int
+}
+
+// Health check failures, wrapped with the details of the failing call
+var (
+    ErrUnreachable        = errors.New("SonarQube server is not reachable")
+    ErrInvalidToken       = errors.New("SonarQube token is not valid")
+    ErrNoBrowsePermission = errors.New("SonarQube token cannot browse projects")
+)
+
+// Auth schemes to send the token with
+const (
+    AuthAuto   = "auto"
+    AuthBasic  = "basic"
+    AuthBearer = "bearer"
+)
+
+// Check the server is reachable and detect its version to choose the auth scheme and API variants, then make sure
+// the token is valid and allowed to browse projects.
+// With the "auto" scheme, SonarQube 10.0 and newer get a Bearer token, older ones a basic-auth username.
+func CheckAvailability(sonarqubeURL, sonarqubeToken, authScheme string) (*Server, error) {
+    server := &Server{URL: sonarqubeURL, Token: sonarqubeToken, AuthScheme: AuthBasic}
+
     healthCheckURL := fmt.Sprintf("%s/api/server/version", sonarqubeURL)
-    resp, err := http.Get(healthCheckURL)
+    req, err := http.NewRequest("GET", healthCheckURL, nil)
     if err != nil {
-        return fmt.Errorf("[ERROR] SonarQube server is not reachable: %v", err)
+        return nil, fmt.Errorf("creating GET request: %v", err)
+    }
+    // The version endpoint is public, but some instances force authentication
+    req.SetBasicAuth(sonarqubeToken, "")
+
+    client := httpclient.Client()
+    resp, err := client.Do(req)
+    if err != nil {
+        return nil, fmt.Errorf("%w: %v", ErrUnreachable, err)
     }
     defer resp.Body.Close()
     if resp.StatusCode != http.StatusOK {
-        return fmt.Errorf("[ERROR] SonarQube server returned non-OK status: %d", resp.StatusCode)
+        return nil, fmt.Errorf("%w: %s returned %d", ErrUnreachable, healthCheckURL, resp.StatusCode)
+    }
+
+    body, err := ioutil.ReadAll(resp.Body)
+    if err != nil {
+        return nil, fmt.Errorf("reading response body: %v", err)
+    }
+    server.Version = strings.TrimSpace(string(body))
+    server.major, server.minor = parseServerVersion(server.Version)
+
+    switch authScheme {
+    case AuthBasic, AuthBearer:
+        server.AuthScheme = authScheme
+    case AuthAuto, "":
+        if server.AtLeast(10, 0) {
+            server.AuthScheme = AuthBearer
+        }
+    default:
+        return nil, fmt.Errorf("unknown SonarQube auth scheme: %s", authScheme)
+    }
+
+    if err := server.validateToken(); err != nil {
+        return nil, err
+    }
+    if err := server.checkBrowsePermission(); err != nil {
+        return nil, err
+    }
+    return server, nil
+}
+
+// api/authentication/validate answers 200 for any token, the body tells if it is valid
+func (s *Server) validateToken() error {
+    body, status, err := s.get("/api/authentication/validate")
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrUnreachable, err)
+    }
+    if status != http.StatusOK {
+        return fmt.Errorf("%w: api/authentication/validate returned %d", ErrInvalidToken, status)
+    }
+
+    var response struct {
+        Valid bool `json:"valid"`
+    }
+    if err := json.Unmarshal(body, &response); err != nil {
+        return fmt.Errorf("unmarshalling response: %v", err)
+    }
+    if !response.Valid {
+        return fmt.Errorf("%w, check SONARQUBE_TOKEN and SONARQUBE_AUTH", ErrInvalidToken)
+    }
+    return nil
+}
+
+// api/components/search only returns the projects the token may browse, so it answers 200 with no
+// projects at all when the token lacks the permission. Searching a single project is enough to find out.
+func (s *Server) checkBrowsePermission() error {
+    body, status, err := s.get("/api/components/search?qualifiers=TRK&ps=1")
+    if err != nil {
+        return fmt.Errorf("%w: %v", ErrUnreachable, err)
+    }
+    switch status {
+    case http.StatusOK:
+    case http.StatusUnauthorized:
+        return fmt.Errorf("%w: api/components/search returned %d", ErrInvalidToken, status)
+    default:
+        return fmt.Errorf("%w: api/components/search returned %d", ErrNoBrowsePermission, status)
+    }
+
+    var response struct {
+        Paging struct {
+            Total int `json:"total"`
+        } `json:"paging"`
+        Components []struct {
+            Key string `json:"key"`
+        } `json:"components"`
+    }
+    if err := json.Unmarshal(body, &response); err != nil {
+        return fmt.Errorf("unmarshalling response: %v", err)
+    }
+    if response.Paging.Total == 0 || len(response.Components) == 0 {
+        return fmt.Errorf("%w: api/components/search found no project the token may browse", ErrNoBrowsePermission)
     }
     return nil
 }
 
+// get sends an authorized GET request to the server and returns the body and status code
+func (s *Server) get(path string) ([]byte, int, error) {
+    req, err := http.NewRequest("GET", s.URL+path, nil)
+    if err != nil {
+        return nil, 0, fmt.Errorf("creating GET request: %v", err)
+    }
+    s.Authorize(req)
+
+    resp, err := httpclient.Client().Do(req)
+    if err != nil {
+        return nil, 0, err
+    }
+    defer resp.Body.Close()
+
+    body, err := ioutil.ReadAll(resp.Body)
+    if err != nil {
+        return nil, 0, fmt.Errorf("reading response body: %v", err)
+    }
+    return body, resp.StatusCode, nil
+}
+
+// AtLeast reports whether the server version is major.minor or newer, an unknown version is never new enough
+func (s *Server) AtLeast(major, minor int) bool {
+    return s.major > major || (s.major == major && s.minor >= minor)
+}
+
+// Authorize adds the token to the request with the chosen auth scheme
+func (s *Server) Authorize(req *http.Request) {
+    if s.AuthScheme == AuthBearer {
+        req.Header.Set("Authorization", "Bearer "+s.Token)
+        return
+    }
+    req.SetBasicAuth(s.Token, "")
+}
+
+// Versions look like "10.4.1.88267", only major and minor are needed
+func parseServerVersion(version string) (int, int) {
+    parts := strings.Split(version, ".")
+    major, err := strconv.Atoi(parts[0])
+    if err != nil {
+        return 0, 0
+    }
+    minor := 0
+    if len(parts) > 1 {
+        minor, _ = strconv.Atoi(parts[1])
+    }
+    return major, minor
+}
+
 // In order to find a project in Sonarqube, we need the projectKey
-func FindProjectKey(dependency, sonarqubeURL, sonarqubeToken string) (string, error) {
+func FindProjectKey(dependency string, server *Server) (string, error) {
     // Searching through the sonarqube to find the 
-    searchURL := fmt.Sprintf("%s/api/components/search?qualifiers=TRK&q=%s", sonarqubeURL, dependency)
-    client := &http.Client{}
+    searchURL := fmt.Sprintf("%s/api/components/search?qualifiers=TRK&q=%s", server.URL, dependency)
+    client := httpclient.Client()
     req, err := http.NewRequest("GET", searchURL, nil)
     if err != nil {
-        return "", fmt.Errorf("[ERROR] creating GET request: %v", err)
+        return "", fmt.Errorf("creating GET request: %v", err)
     }
-    req.SetBasicAuth(sonarqubeToken, "")
+    server.Authorize(req)
     resp, err := client.Do(req)
     if err != nil {
-        return "", fmt.Errorf("[ERROR] sending GET request: %v", err)
+        return "", fmt.Errorf("sending GET request: %v", err)
     }
     defer resp.Body.Close()
 
     body, err := ioutil.ReadAll(resp.Body)
     if err != nil {
-        return "", fmt.Errorf("[ERROR] reading response body: %v", err)
+        return "", fmt.Errorf("reading response body: %v", err)
     }
 
     // Through the response make sure we get the key related to the specified project
@@ -61,47 +233,65 @@ func FindProjectKey(dependency, sonarqubeURL, sonarqubeToken string) (string, er
     return "", fmt.Errorf("project key not found for dependency %s", dependency)
 }
 
-// Check the sonar status of a specific components version
-func SonarCheck(dependency, version, sonarqubeURL, sonarqubeToken string, debug bool) (string, error) {
+// Dates of analyses look like "2024-08-08T11:31:26+0200"
+const analysisDateFormat = "2006-01-02T15:04:05-0700"
+
+// Check the sonar status of a specific components version, on the main branch unless a branch is given.
+// The branch of the result is only set once SonarQube answered for it, a branch that was never analysed
+// is no error but a result without branch and status, so the policy reports it.
+func SonarCheck(dependency, version, branch string, server *Server) (Analysis, error) {
+        result := Analysis{}
+        logger := slog.With("projectKey", dependency, "version", version)
+
+        // The branch parameter came with SonarQube 6.6, older servers ignore it and answer for the main branch
+        if branch != "" && server.major > 0 && !server.AtLeast(6, 6) {
+                return result, fmt.Errorf("branch %s needs SonarQube 6.6 or newer, the server is %s", branch, server.Version)
+        }
+
         // Construct the URL with the provided dependency key
-        url := fmt.Sprintf("%s/api/project_analyses/search?ps=200&project=%s", sonarqubeURL, dependency)
+        url := fmt.Sprintf("%s/api/project_analyses/search?ps=200&project=%s", server.URL, dependency)
+        if branch != "" {
+                url += "&branch=" + neturl.QueryEscape(branch)
+        }
 
-        client := &http.Client{}
+        client := httpclient.Client()
         req, err := http.NewRequest("GET", url, nil)
         if err != nil {
-                return "", fmt.Errorf("[ERROR] creating GET request: %v", err)
+                return result, fmt.Errorf("creating GET request: %v", err)
         }
 
-        req.SetBasicAuth(sonarqubeToken, "")
+        server.Authorize(req)
         resp, err := client.Do(req)
         if err != nil {
-                return "", fmt.Errorf("[ERROR] sending GET request: %v", err)
+                return result, fmt.Errorf("sending GET request: %v", err)
         }
         defer resp.Body.Close()
 
         body, err := ioutil.ReadAll(resp.Body)
         if err != nil {
-                return "", fmt.Errorf("[ERROR] reading response body: %v", err)
-        }
-
-        // Debug output
-        if debug {
-                responseString := string(body)
-                fmt.Printf("Response for dependency %s-%s: %s\n", dependency, version, responseString)
+                return result, fmt.Errorf("reading response body: %v", err)
         }
 
         // Parse the JSON response
         var responseMap map[string]interface{}
         if err := json.Unmarshal(body, &responseMap); err != nil {
-                return "", fmt.Errorf("[ERROR] unmarshalling response: %v", err)
+                return result, fmt.Errorf("unmarshalling response: %v", err)
         }
         // Check for errors in the response
         if errors, ok := responseMap["errors"].([]interface{}); ok && len(errors) > 0 {
                 firstError := errors[0].(map[string]interface{})
-                if msg, ok := firstError["msg"].(string); ok {
-                        return "", fmt.Errorf("SonarQube API error: %s", msg)
+                msg, _ := firstError["msg"].(string)
+                // The project was found before, so a 404 means the branch doesn't exist
+                if branch != "" && resp.StatusCode == http.StatusNotFound {
+                        logger.Debug("Branch not analysed", "branch", branch, "error", msg)
+                        result.Status = GateNone
+                        return result, nil
+                }
+                if msg != "" {
+                        return result, fmt.Errorf("SonarQube API error: %s", msg)
                 }
         }
+        result.Branch = branch
 
         // Find the analysis entry for the specified version or the nearest previous version
 	// In Sonarqube projects history, when a project passes the quality gate continously, 
@@ -109,10 +299,9 @@ func SonarCheck(dependency, version, sonarqubeURL, sonarqubeToken string, debug
 	// so we need the check the lower versions status which has the field.
         analyses, ok := responseMap["analyses"].([]interface{})
         if !ok {
-                return "", fmt.Errorf("unexpected response format: missing 'analyses'")
+                return result, fmt.Errorf("unexpected response format: missing 'analyses'")
         }
 
-        var latestQualityGateStatus string
         var foundVersion bool
 
         for _, analysis := range analyses {
@@ -146,15 +335,71 @@ func SonarCheck(dependency, version, sonarqubeURL, sonarqubeToken string, debug
                         }
                         if category, ok := eventMap["category"].(string); ok && category == "QUALITY_GATE" {
                                 if name, ok := eventMap["name"].(string); ok {
-                                        latestQualityGateStatus = name
-                                        return latestQualityGateStatus, nil
+                                        result.Version = projectVersion
+                                        if date, ok := analysisMap["date"].(string); ok {
+                                                // A zero date fails a maximum analysis age, the log tells why
+                                                if result.Date, err = time.Parse(analysisDateFormat, date); err != nil {
+                                                        logger.Warn("Analysis date not readable", "date", date, "error", err)
+                                                }
+                                        }
+                                        // The status code of the analysis doesn't depend on the locale, the event name
+                                        // is only the fallback when it can't be read
+                                        result.Status = GateNone
+                                        if key, ok := analysisMap["key"].(string); ok {
+                                                result.Key = key
+                                                result.Status, result.Conditions, err = server.GateStatus(key)
+                                                if err != nil {
+                                                        logger.Debug("Quality gate status of analysis not readable, using the event name", "analysis", key, "error", err)
+                                                }
+                                        }
+                                        if result.Status == GateNone {
+                                                result.Status = GateStatusFromEventName(name)
+                                        }
+                                        return result, nil
                                 }
                         }
                 }
         }
-        if latestQualityGateStatus != "" {
-                return latestQualityGateStatus, nil
-        }
-        return "No quality gate status found before the specified version", nil
+        // No quality gate status found before the specified version
+        result.Status = GateNone
+        return result, nil
 }
 
+// GateStatus returns the quality gate status code and the conditions of an analysis
+func (s *Server) GateStatus(analysisKey string) (GateStatus, []Condition, error) {
+    body, status, err := s.get("/api/qualitygates/project_status?analysisId=" + neturl.QueryEscape(analysisKey))
+    if err != nil {
+        return GateNone, nil, err
+    }
+    if status != http.StatusOK {
+        return GateNone, nil, fmt.Errorf("api/qualitygates/project_status returned %d", status)
+    }
+
+    var response struct {
+        ProjectStatus struct {
+            Status     string `json:"status"`
+            Conditions []struct {
+                MetricKey      string `json:"metricKey"`
+                Status         string `json:"status"`
+                Comparator     string `json:"comparator"`
+                ErrorThreshold string `json:"errorThreshold"`
+                ActualValue    string `json:"actualValue"`
+            } `json:"conditions"`
+        } `json:"projectStatus"`
+    }
+    if err := json.Unmarshal(body, &response); err != nil {
+        return GateNone, nil, fmt.Errorf("unmarshalling response: %v", err)
+    }
+
+    var conditions []Condition
+    for _, c := range response.ProjectStatus.Conditions {
+        conditions = append(conditions, Condition{
+            Metric:         c.MetricKey,
+            Status:         ParseGateStatus(c.Status),
+            Comparator:     c.Comparator,
+            ErrorThreshold: c.ErrorThreshold,
+            ActualValue:    c.ActualValue,
+        })
+    }
+    return ParseGateStatus(response.ProjectStatus.Status), conditions, nil
+}
@@ -0,0 +1,96 @@
+package sonarqube
+
+import (
+    "errors"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+)
+
+// newSonarQube stands in for the analyses and quality gate API of a project with an analysis of 1.0.0 on main
+func newSonarQube(t *testing.T) *Server {
+    mux := http.NewServeMux()
+    mux.HandleFunc("/api/project_analyses/search", func(w http.ResponseWriter, r *http.Request) {
+        if branch := r.URL.Query().Get("branch"); branch != "" && branch != "main" {
+            w.WriteHeader(http.StatusNotFound)
+            w.Write([]byte(`{"errors":[{"msg":"Branch '` + branch + `' in project 'app' not found"}]}`))
+            return
+        }
+        w.Write([]byte(`{"analyses":[{"key":"A1","date":"2026-10-01T10:00:00+0200","projectVersion":"1.0.0",
+            "events":[{"category":"QUALITY_GATE","name":"Passed"}]}]}`))
+    })
+    mux.HandleFunc("/api/qualitygates/project_status", func(w http.ResponseWriter, r *http.Request) {
+        w.Write([]byte(`{"projectStatus":{"status":"OK","conditions":[]}}`))
+    })
+    server := httptest.NewServer(mux)
+    t.Cleanup(server.Close)
+    return &Server{URL: server.URL, Token: "t", AuthScheme: "bearer"}
+}
+
+func TestSonarCheckBranch(t *testing.T) {
+    server := newSonarQube(t)
+
+    tests := []struct {
+        branch     string
+        wantBranch string
+        wantStatus GateStatus
+    }{
+        {"", "", GateOK},
+        {"main", "main", GateOK},
+        {"feature", "", GateNone},
+    }
+    for _, test := range tests {
+        analysis, err := SonarCheck("app", "1.0.0", test.branch, server)
+        if err != nil {
+            t.Fatalf("SonarCheck on branch %q: %v", test.branch, err)
+        }
+        if analysis.Branch != test.wantBranch || analysis.Status != test.wantStatus {
+            t.Errorf("SonarCheck on branch %q = branch %q status %s, want branch %q status %s",
+                test.branch, analysis.Branch, analysis.Status, test.wantBranch, test.wantStatus)
+        }
+    }
+}
+
+func TestSonarCheckBranchOnOldServer(t *testing.T) {
+    server := newSonarQube(t)
+    server.Version = "6.5.0.27846"
+    server.major, server.minor = parseServerVersion(server.Version)
+
+    if _, err := SonarCheck("app", "1.0.0", "release", server); err == nil {
+        t.Errorf("SonarCheck on branch release of SonarQube %s: expected an error", server.Version)
+    }
+    if analysis, err := SonarCheck("app", "1.0.0", "", server); err != nil || analysis.Status != GateOK {
+        t.Errorf("SonarCheck on the main branch of SonarQube %s = %s, %v", server.Version, analysis.Status, err)
+    }
+}
+
+func TestCheckBrowsePermission(t *testing.T) {
+    tests := []struct {
+        name    string
+        status  int
+        body    string
+        wantErr error
+    }{
+        {"projects visible", http.StatusOK, `{"paging":{"pageIndex":1,"pageSize":1,"total":12},"components":[{"key":"app"}]}`, nil},
+        {"no project visible", http.StatusOK, `{"paging":{"pageIndex":1,"pageSize":1,"total":0},"components":[]}`, ErrNoBrowsePermission},
+        {"forbidden", http.StatusForbidden, `{"errors":[{"msg":"Insufficient privileges"}]}`, ErrNoBrowsePermission},
+        {"unauthorized", http.StatusUnauthorized, ``, ErrInvalidToken},
+    }
+    for _, test := range tests {
+        t.Run(test.name, func(t *testing.T) {
+            stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+                w.WriteHeader(test.status)
+                w.Write([]byte(test.body))
+            }))
+            defer stub.Close()
+
+            err := (&Server{URL: stub.URL, Token: "t", AuthScheme: AuthBearer}).checkBrowsePermission()
+            if test.wantErr == nil && err != nil {
+                t.Errorf("checkBrowsePermission: %v", err)
+            }
+            if test.wantErr != nil && !errors.Is(err, test.wantErr) {
+                t.Errorf("checkBrowsePermission = %v, want %v", err, test.wantErr)
+            }
+        })
+    }
+}
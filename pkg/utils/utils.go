@@ -2,7 +2,7 @@ package utils
 
 import (
     "fmt"
-    "log"
+    "log/slog"
     "regexp"
     "os"
     "strings"
@@ -12,29 +12,100 @@ import (
     "compress/gzip"
     "io"
     "io/ioutil"
+    "net/url"
 
     "gopkg.in/yaml.v2"
 )
 
 func Help() {
-        fmt.Println(`Usage: SonarCheck [OPTIONS] [ignore rules]
+        fmt.Println(`Usage: SonarCheck [COMMAND] [OPTIONS] [ARGS]
 
 Check umbrella charts if their subcharts (dependencies) are already passed the Sonarqube analyses.
 
+Commands:
+  check [ignore rules]  Check every component against the SonarQube quality gate (default command)
+  deps                  List the discovered components and their versions
+  resolve               Show the SonarQube project key of every component
+  explain <component>   Explain how a component is found, classified and checked
+  config                Print the resolved config with secrets redacted
+  version               Print the version of SonarCheck
+  help                  Show this help message and exit
+
+  Run "SonarCheck <command> -h" for the options of a command.
+
 Options:
-  -h                Show this help message and exit
-  -v                Enable verbose mode (This will override VERBOSE env)
-  -d                Enable debug mode (This will override DEBUG env)
+  -h                Show the options of the command and exit
+  -log-level        Log level: debug, info, warn or error (This will override LOG_LEVEL env)
+  -log-format       Log format: text or json (This will override LOG_FORMAT env)
+  -v, -d            Deprecated, same as -log-level debug
+  -promote          check only: promote the umbrella chart (or build) only if every component passes
+  -dry-run          Only simulate the promotion (This will override PROMOTE_DRY_RUN env)
+  -config           Path of the config file (default: .sonarcheck.yaml, This will override SONARCHECK_CONFIG env)
+  -print-config     check only: print the resolved config with secrets redacted and exit
+  -verify           check only: verify the sonarcheck.status property published on the umbrella chart
+  -<setting>        Every setting below is also a flag, e.x. -chart-name for CHART_NAME, see "SonarCheck <command> -h"
 
 Environments:
+  Every setting can also be set as a flag or in the config file, see README.md.
+  Flags win over env, env over the config file.
+
+  SONARCHECK_CONFIG Optional  Path of the config file (default: .sonarcheck.yaml)
+  IGNORE_RULES      Optional  Comma separated ignore patterns, the [ignore rules] argument wins over it
+  FAIL_WHEN         Optional  Expression deciding when the check fails (default: count(severity == "error") > 0)
+  WAIVERS_FILE      Optional  YAML file of waivers: pattern, versions, reason, owner, ticket and expires (see README.md)
   SONARQUBE_TOKEN   Required  Token that you need to check the status of applications
-  JFROG_CREDENTIALS Required  Credentials that you need to get the version of dependencies. e.x. user:password
-  CHART_NAME        Required  Umbrella chart name e.x. tramon-lt
-  CHART_VERSION     Required  Umbrella chart version e.x. 202406.827.0
+  JFROG_CREDENTIALS Optional  Credentials that you need to get the version of dependencies. e.x. user:password,
+                              bearer:<access token>, apikey:<api key> or anonymous
+                              (default: docker config.json credentials of the registry host, otherwise anonymous)
+  JFROG_HOST_CREDENTIALS Optional Comma separated host=credential pairs, when charts live in different registries
+                              e.x. charts.example.com=bearer:<token>,other.example.com=user:password
+  DOCKER_CONFIG_FILE Optional Docker config.json used to look up registry credentials and credential helpers
+                              (default: $DOCKER_CONFIG/config.json or ~/.docker/config.json)
+  CHART_NAME        Required  Umbrella chart name e.x. tramon-lt (chart source only)
+  CHART_VERSION     Required  Umbrella chart version e.x. 202406.827.0 (chart source only)
+  DEPENDENCY_SOURCE Optional  Where to find the components: chart or buildinfo
+                              (default: buildinfo when BUILD_NAME or BUILD_INFO_FILE is set, otherwise chart)
+  BUILD_NAME        Optional  JFrog build name to read dependencies from api/build/<name>/<number>
+  BUILD_NUMBER      Optional  JFrog build number, required together with BUILD_NAME
+  BUILD_INFO_FILE   Optional  Exported build-info JSON file to read dependencies from instead of the API
   SONARQUBE_URL     Optional  The URL of the sonarqube instance (default: http://sonar.com/)
+  SONARQUBE_AUTH    Optional  How to send the token: auto, bearer or basic (default: auto, bearer from SonarQube 10.0)
   JFROG_URL         Optional  The URL of the jfrog instance (default: http://artifactory.com/)
-  VERBOSE           Optional  Enable verbose mode
-  DEBUG             Optional  Enable debug mode
+  VERSION_SOURCES   Optional  Comma separated order to resolve component versions (default: appVersion,version,annotation)
+  VERSION_ANNOTATION Optional Chart annotation holding the version for the annotation source (default: sonarcheck/version)
+  INTERNAL_ORIGINS  Optional  Comma separated hosts or URL prefixes of internal charts e.x. git.example.com,oci://artifactory.example.com
+                              Charts from other origins are reported as external and not checked
+  PUBLISH_PROPERTIES Optional Write sonarcheck.status, sonarcheck.timestamp and per component results
+                              onto the umbrella chart manifest in Artifactory
+  PROMOTE_TARGET_REPO Optional Repository to promote into e.x. prod-charts, required with -promote
+  PROMOTE_STATUS    Optional  Status recorded by the build promotion (default: sonar-passed)
+  PROMOTE_COMMENT   Optional  Comment recorded by the build promotion
+  PROMOTE_DRY_RUN   Optional  Only simulate the promotion
+  PROMOTE_AUDIT_FILE Optional JSON lines file recording every promotion decision (default: sonarcheck-promotion.jsonl)
+  TLS_CA_BUNDLE     Optional  PEM file with extra CA certificates to trust, e.x. an internal CA
+  TLS_CLIENT_CERT   Optional  PEM client certificate for mutual TLS, requires TLS_CLIENT_KEY
+  TLS_CLIENT_KEY    Optional  PEM private key of the client certificate
+  TLS_INSECURE      Optional  Skip TLS certificate verification, never use this outside of testing
+  HTTPS_PROXY       Optional  Proxy for outgoing requests, hosts in NO_PROXY are reached directly
+  HTTP_TIMEOUT      Optional  Timeout of every call to SonarQube and Artifactory, chart downloads included (default: 2m)
+  REPORT_JSON       Optional  Write a JSON report of the check to this file
+  REPORT_JUNIT      Optional  Write a JUnit XML report of the check to this file, for CI test dashboards
+  REPORT_SARIF      Optional  Write a SARIF 2.1.0 report of the failing components to this file
+  REPORT_MARKDOWN   Optional  Append a Markdown summary of the check to this file, e.x. $GITHUB_STEP_SUMMARY
+  REPORT_HTML       Optional  Write a self-contained HTML report of the check to this file
+  LOG_LEVEL         Optional  Log level: debug, info, warn or error (default: info)
+  LOG_FORMAT        Optional  Log format: text or json for log collectors (default: text)
+  HTTP_TRACE_BODIES Optional  Log the bodies of HTTP calls at the debug level, credentials redacted
+  HTTP_TRACE_HAR    Optional  Write every HTTP call to this HAR file for support tickets, credentials redacted
+  VERBOSE           Optional  Deprecated, same as LOG_LEVEL=debug
+  DEBUG             Optional  Deprecated, same as LOG_LEVEL=debug
+
+Exit codes:
+  0                 All checked components passed
+  1                 One or more components failed the quality gate or have no usable status
+  2                 One or more components have no SonarQube project, all others passed
+  3                 Configuration error: missing or invalid settings, flags, credentials or ignore rules
+  4                 SonarQube or Artifactory unavailable or answering with errors
 
 Ignore rules:
   You can specify comma separated ignore patterns to not to check sonarqube status for those which match e.x.
@@ -101,33 +172,44 @@ func ExtractTarGz(gzipPath, outputDir string) error {
                         }
                         outFile.Close()
                 default:
-                        log.Printf("Ignoring unknown type: %c in %s\n", header.Typeflag, header.Name)
+                        slog.Warn("Ignoring unknown type in chart archive", "type", string(header.Typeflag), "file", header.Name)
                 }
         }
         return nil
 }
 
 // cleanWorkingDirectory removes any existing files or directories with the name pattern "layer_*"
-func CleanWorkingDirectory(cleaningPattern string, verbose, debug bool) {
+func CleanWorkingDirectory(cleaningPattern string) {
 	files, err := filepath.Glob(cleaningPattern)
         if err != nil {
-                fmt.Println("Error cleaning working directory:", err)
+                slog.Error("Cleaning working directory", "error", err)
                 return
         }
 
         for _, file := range files {
                 err = os.RemoveAll(file)
                 if err != nil {
-                        fmt.Println("Error removing", file, ":", err)
-                } else if verbose || debug {
-                        fmt.Println("Removed", file)
+                        slog.Error("Removing extracted layer", "path", file, "error", err)
+                } else {
+                        slog.Debug("Removed extracted layer", "path", file)
                 }
         }
 }
 
-// extractAppVersions scans the "charts" subdirectories in each layer and extracts the appVersion from Chart.yaml
-func ExtractAppVersions(cleaningPattern string) (map[string]string, error) {
-	dependencies := make(map[string]string)
+// Component describes a subchart found inside the umbrella chart
+type Component struct {
+        Name          string
+        Version       string
+        VersionSource string
+        Path          string
+        Repository    string
+        Chart         Chart
+}
+
+// extractComponents scans the "charts" subdirectories in each layer and collects every subchart with its version,
+// resolved through the versionSources chain (see ResolveVersion)
+func ExtractComponents(cleaningPattern string, versionSources []string, versionAnnotation string) ([]Component, error) {
+        var components []Component
 
         // Look for all "layer_*" directories
         layers, err := filepath.Glob(cleaningPattern)
@@ -147,31 +229,111 @@ func ExtractAppVersions(cleaningPattern string) (map[string]string, error) {
                         if strings.HasSuffix(chartPath, ".tgz") {
                                 continue
                         }
-                        chartName := filepath.Base(filepath.Dir(chartPath))
-                        appVersion, err := GetAppVersionFromChart(chartPath)
+                        chart, err := ReadChart(chartPath)
                         if err != nil {
-                                log.Printf("Error reading appVersion from %s: %v\n", chartPath, err)
+                                slog.Error("Reading chart", "path", chartPath, "error", err)
                                 continue
                         }
-			dependencies[chartName] = appVersion
+                        chartName := filepath.Base(filepath.Dir(chartPath))
+
+                        // The umbrella chart two levels up declares where the subchart came from
+                        umbrellaPath := filepath.Join(filepath.Dir(filepath.Dir(filepath.Dir(chartPath))), "Chart.yaml")
+                        repository := ""
+                        if umbrella, err := ReadChart(umbrellaPath); err == nil {
+                                repository = umbrella.DependencyRepository(chartName)
+                        }
+
+                        version, versionSource := ResolveVersion(chart, versionSources, versionAnnotation)
+                        components = append(components, Component{
+                                Name:          chartName,
+                                Version:       version,
+                                VersionSource: versionSource,
+                                Path:          chartPath,
+                                Repository:    repository,
+                                Chart:         chart,
+                        })
                 }
         }
-        return dependencies, nil
+        return components, nil
+}
+
+type ChartDependency struct {
+        Name       string `yaml:"name"`
+        Alias      string `yaml:"alias"`
+        Version    string `yaml:"version"`
+        Repository string `yaml:"repository"`
 }
 
 type Chart struct {
-        AppVersion string `yaml:"appVersion"`
+        Name         string            `yaml:"name"`
+        Version      string            `yaml:"version"`
+        AppVersion   string            `yaml:"appVersion"`
+        Type         string            `yaml:"type"`
+        Home         string            `yaml:"home"`
+        Sources      []string          `yaml:"sources"`
+        Annotations  map[string]string `yaml:"annotations"`
+        Dependencies []ChartDependency `yaml:"dependencies"`
 }
 
-// getAppVersionFromChart reads the Chart.yaml file and returns the appVersion
-func GetAppVersionFromChart(chartPath string) (string, error) {
+// Sources of a component version, tried in the configured order
+const (
+        VersionSourceAppVersion = "appVersion"
+        VersionSourceVersion    = "version"
+        VersionSourceAnnotation = "annotation"
+)
+
+// ResolveVersion walks the versionSources chain and returns the first non-empty version and the source it came from.
+// An empty version means none of the sources had a value.
+func ResolveVersion(chart Chart, versionSources []string, versionAnnotation string) (string, string) {
+        for _, source := range versionSources {
+                var version string
+                switch source {
+                case VersionSourceAppVersion:
+                        version = chart.AppVersion
+                case VersionSourceVersion:
+                        version = chart.Version
+                case VersionSourceAnnotation:
+                        version = chart.Annotations[versionAnnotation]
+                default:
+                        slog.Warn("Ignoring unknown version source", "source", source)
+                }
+                if version = strings.TrimSpace(version); version != "" {
+                        return version, source
+                }
+        }
+        return "", ""
+}
+
+// DependencyRepository returns the repository a dependency was pulled from, matched by name or alias
+func (c Chart) DependencyRepository(name string) string {
+        for _, dependency := range c.Dependencies {
+                if dependency.Name == name || dependency.Alias == name {
+                        return dependency.Repository
+                }
+        }
+        return ""
+}
+
+// readChart reads and parses a Chart.yaml file
+func ReadChart(chartPath string) (Chart, error) {
+        var chart Chart
+
         data, err := ioutil.ReadFile(chartPath)
         if err != nil {
-                return "", err
+                return chart, err
         }
 
-        var chart Chart
         err = yaml.Unmarshal(data, &chart)
+        if err != nil {
+                return chart, err
+        }
+
+        return chart, nil
+}
+
+// getAppVersionFromChart reads the Chart.yaml file and returns the appVersion
+func GetAppVersionFromChart(chartPath string) (string, error) {
+        chart, err := ReadChart(chartPath)
         if err != nil {
                 return "", err
         }
@@ -179,6 +341,71 @@ func GetAppVersionFromChart(chartPath string) (string, error) {
         return chart.AppVersion, nil
 }
 
+// Library charts only provide templates to other charts, so there is nothing to analyse in Sonarqube
+func IsLibraryChart(component Component) bool {
+        return component.Chart.Type == "library"
+}
+
+// A component is internal when the repository it was pulled from is one of the internal origins. Without a remote
+// repository its home and all of its sources have to point at internal origins, a single external one makes it external.
+// Components without any origin information are treated as internal, so they are still checked.
+func IsInternalComponent(component Component, internalOrigins []string) bool {
+        if len(internalOrigins) == 0 {
+                return true
+        }
+
+        // The repository is where the chart actually came from, it wins over what the chart says about itself
+        if component.Repository != "" && !isLocalRepository(component.Repository) {
+                return isInternalLocation(component.Repository, internalOrigins)
+        }
+
+        var locations []string
+        if component.Chart.Home != "" {
+                locations = append(locations, component.Chart.Home)
+        }
+        locations = append(locations, component.Chart.Sources...)
+
+        for _, location := range locations {
+                if !isInternalLocation(location, internalOrigins) {
+                        return false
+                }
+        }
+        return true
+}
+
+func isInternalLocation(location string, internalOrigins []string) bool {
+        for _, origin := range internalOrigins {
+                if matchesOrigin(location, origin) {
+                        return true
+                }
+        }
+        return false
+}
+
+// Local file references and repository aliases are resolved from the umbrella itself
+func isLocalRepository(repository string) bool {
+        return strings.HasPrefix(repository, "file://") || strings.HasPrefix(repository, "@") || strings.HasPrefix(repository, "alias:")
+}
+
+// matchesOrigin compares a location against an origin, which is either a host (sub domains included) or a URL prefix
+func matchesOrigin(location, origin string) bool {
+        origin = strings.TrimSpace(origin)
+        if origin == "" {
+                return false
+        }
+        if strings.Contains(origin, "://") {
+                return strings.HasPrefix(location, origin)
+        }
+
+        host := location
+        if u, err := url.Parse(location); err == nil && u.Host != "" {
+                host = u.Hostname()
+        }
+        host = strings.ToLower(host)
+        origin = strings.ToLower(origin)
+        return host == origin || strings.HasSuffix(host, "."+origin)
+}
+
 // In order to match the ignore rule, we need to compile the pattern
 func CompareWithRegex(ignoreRules, target string) (bool, error) {
         // Split the patterns by comma
@@ -194,7 +421,7 @@ func CompareWithRegex(ignoreRules, target string) (bool, error) {
                 // Compile the pattern as a regular expression
                 re, err := regexp.Compile(anchoredIgnoreRule)
                 if err != nil {
-                        return false, fmt.Errorf("[ERROR] compiling regex pattern '%s': %v", ignoreRule, err)
+                        return false, fmt.Errorf("compiling regex pattern '%s': %v", ignoreRule, err)
                 }
 
                 // Check if the regex matches the target string
@@ -205,30 +432,80 @@ func CompareWithRegex(ignoreRules, target string) (bool, error) {
         return false, nil
 }
 
-// Returns -1 if v1 < v2, 0 if v1 == v2, 1 if v1 > v2
+// Returns -1 if v1 < v2, 0 if v1 == v2, 1 if v1 > v2. Versions are compared semver-style, component by
+// component as numbers ("1.10.0" > "1.9.0", missing components count as 0), a pre-release ("1.0.0-rc.1")
+// comes before its release and build metadata ("+build.5") is ignored.
 func CompareVersions(v1, v2 string) int {
-        v1Int, _ := strconv.Atoi(strings.ReplaceAll(v1, ".", ""))
-        v2Int, _ := strconv.Atoi(strings.ReplaceAll(v2, ".", ""))
+        core1, pre1 := splitVersion(v1)
+        core2, pre2 := splitVersion(v2)
+
+        parts1, parts2 := strings.Split(core1, "."), strings.Split(core2, ".")
+        for i := 0; i < len(parts1) || i < len(parts2); i++ {
+                part1, part2 := "0", "0"
+                if i < len(parts1) {
+                        part1 = parts1[i]
+                }
+                if i < len(parts2) {
+                        part2 = parts2[i]
+                }
+                if result := compareIdentifiers(part1, part2); result != 0 {
+                        return result
+                }
+        }
+
+        // A release is newer than its pre-releases
+        switch {
+        case pre1 == pre2:
+                return 0
+        case pre1 == "":
+                return 1
+        case pre2 == "":
+                return -1
+        }
+        ids1, ids2 := strings.Split(pre1, "."), strings.Split(pre2, ".")
+        for i := 0; i < len(ids1) && i < len(ids2); i++ {
+                if result := compareIdentifiers(ids1[i], ids2[i]); result != 0 {
+                        return result
+                }
+        }
+        return compareInts(len(ids1), len(ids2))
+}
+
+// splitVersion drops a leading "v" and the build metadata, and splits the version into core and pre-release
+func splitVersion(version string) (string, string) {
+        version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+        if i := strings.Index(version, "+"); i >= 0 {
+                version = version[:i]
+        }
+        if i := strings.Index(version, "-"); i >= 0 {
+                return version[:i], version[i+1:]
+        }
+        return version, ""
+}
 
-        if v1Int < v2Int {
+// compareIdentifiers compares numbers as numbers, anything else as text, numbers before text
+func compareIdentifiers(a, b string) int {
+        aInt, aErr := strconv.Atoi(a)
+        bInt, bErr := strconv.Atoi(b)
+        switch {
+        case aErr == nil && bErr == nil:
+                return compareInts(aInt, bInt)
+        case aErr == nil:
                 return -1
-        } else if v1Int > v2Int {
+        case bErr == nil:
                 return 1
         }
-        return 0
+        return strings.Compare(a, b)
 }
 
-// Print the status of each component and the whole project status
-func LogStatus(dependency, version, status, projectStatus string, verbose, debug bool) string {
-    if (verbose || debug) && status == "Passed" {
-        log.Printf("%s-%s: %s", dependency, version, status)
-    } else if status == "Failed" {
-        log.Printf("%s-%s: %s", dependency, version, status)
-        projectStatus = "notOK"
-    } else if status != "Failed" && status != "Passed" {
-        log.Printf("%s-%s: %s (UNKNOWN STATUS)", dependency, version, status)
-        projectStatus = "notOK"
-    }
-    return projectStatus
+func compareInts(a, b int) int {
+        if a < b {
+                return -1
+        } else if a > b {
+                return 1
+        }
+        return 0
 }
 
+// StatusNoVersion is reported for components whose version could not be resolved from the chart
+const StatusNoVersion = "NoVersion"
@@ -0,0 +1,71 @@
+package utils
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+        tests := []struct {
+                v1, v2 string
+                want   int
+        }{
+                {"1.0.0", "1.0.0", 0},
+                {"1.10.0", "1.9.0", 1},
+                {"1.10.0", "2.0.0", -1},
+                {"2.0", "1.10.0", 1},
+                {"1.2.0", "1.20", -1},
+                {"1.10.0", "11.0.0", -1},
+                {"1.2", "1.2.0", 0},
+                {"v1.2.3", "1.2.3", 0},
+                {"1.0.0-rc.1", "1.0.0", -1},
+                {"1.0.0-rc.2", "1.0.0-rc.10", -1},
+                {"1.0.0-alpha", "1.0.0-alpha.1", -1},
+                {"1.0.0-alpha.1", "1.0.0-beta", -1},
+                {"1.0.0+build.5", "1.0.0", 0},
+        }
+        for _, test := range tests {
+                if got := CompareVersions(test.v1, test.v2); got != test.want {
+                        t.Errorf("CompareVersions(%q, %q) = %d, want %d", test.v1, test.v2, got, test.want)
+                }
+                if got := CompareVersions(test.v2, test.v1); got != -test.want {
+                        t.Errorf("CompareVersions(%q, %q) = %d, want %d", test.v2, test.v1, got, -test.want)
+                }
+        }
+}
+
+func TestIsInternalComponent(t *testing.T) {
+        origins := []string{"git.example.com", "oci://artifactory.example.com"}
+        tests := []struct {
+                name      string
+                component Component
+                want      bool
+        }{
+                {"no origin information", Component{}, true},
+                {"internal repository", Component{Repository: "oci://artifactory.example.com/charts"}, true},
+                {"external repository", Component{Repository: "https://charts.bitnami.com/bitnami"}, false},
+                {"external repository wins over internal sources", Component{
+                        Repository: "https://charts.bitnami.com/bitnami",
+                        Chart:      Chart{Home: "https://git.example.com/team/app", Sources: []string{"https://git.example.com/team/app"}},
+                }, false},
+                {"internal repository wins over external sources", Component{
+                        Repository: "oci://artifactory.example.com/charts",
+                        Chart:      Chart{Sources: []string{"https://github.com/bitnami/charts"}},
+                }, true},
+                {"local repository falls back to the chart", Component{
+                        Repository: "file://../app",
+                        Chart:      Chart{Home: "https://git.example.com/team/app"},
+                }, true},
+                {"internal home and sources", Component{Chart: Chart{Home: "https://git.example.com/team/app", Sources: []string{"https://sub.git.example.com/team/app"}}}, true},
+                {"external source among internal ones", Component{Chart: Chart{
+                        Home:    "https://git.example.com/team/app",
+                        Sources: []string{"https://git.example.com/team/app", "https://github.com/bitnami/charts"},
+                }}, false},
+                {"external home", Component{Chart: Chart{Home: "https://nginx.org"}}, false},
+        }
+        for _, test := range tests {
+                if got := IsInternalComponent(test.component, origins); got != test.want {
+                        t.Errorf("%s: IsInternalComponent = %v, want %v", test.name, got, test.want)
+                }
+        }
+        if !IsInternalComponent(Component{Repository: "https://charts.bitnami.com/bitnami"}, nil) {
+                t.Errorf("IsInternalComponent without internal origins = false, want true")
+        }
+}
@@ -0,0 +1,178 @@
+package waiver
+
+import (
+    "fmt"
+    "io/ioutil"
+    "regexp"
+    "strings"
+    "time"
+
+    "gopkg.in/yaml.v2"
+
+    "sonarcheck/pkg/utils"
+)
+
+// DateFormat of the expiry dates in the waivers file
+const DateFormat = "2006-01-02"
+
+// Waiver excuses the components matching the pattern from the quality gate, with the reason and
+// the people accountable for it. A waiver without an expiry date applies until it is removed.
+type Waiver struct {
+    Pattern  string `yaml:"pattern" json:"pattern"`
+    Versions string `yaml:"versions,omitempty" json:"versions,omitempty"`
+    Reason   string `yaml:"reason" json:"reason"`
+    Owner    string `yaml:"owner" json:"owner"`
+    Ticket   string `yaml:"ticket,omitempty" json:"ticket,omitempty"`
+    Expires  string `yaml:"expires,omitempty" json:"expires,omitempty"`
+
+    re      *regexp.Regexp
+    expires time.Time
+}
+
+// File is the layout of the waivers file
+type File struct {
+    Waivers []Waiver `yaml:"waivers"`
+}
+
+// Load reads and validates the waivers file, every waiver needs a pattern, a reason and an owner
+func Load(path string) ([]Waiver, error) {
+    data, err := ioutil.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("reading waivers file: %v", err)
+    }
+
+    var file File
+    if err := yaml.UnmarshalStrict(data, &file); err != nil {
+        return nil, fmt.Errorf("parsing waivers file %s: %v", path, err)
+    }
+    for i := range file.Waivers {
+        if err := file.Waivers[i].compile(); err != nil {
+            return nil, fmt.Errorf("waiver %d in %s: %v", i+1, path, err)
+        }
+    }
+    return file.Waivers, nil
+}
+
+func (w *Waiver) compile() error {
+    if w.Pattern == "" || w.Reason == "" || w.Owner == "" {
+        return fmt.Errorf("pattern, reason and owner are required")
+    }
+    // The pattern has to match the whole component name, like the ignore rules
+    re, err := regexp.Compile("^" + w.Pattern + "$")
+    if err != nil {
+        return fmt.Errorf("compiling pattern '%s': %v", w.Pattern, err)
+    }
+    w.re = re
+
+    if _, err := parseConstraint(w.Versions); err != nil {
+        return err
+    }
+    if w.Expires != "" {
+        w.expires, err = time.Parse(DateFormat, w.Expires)
+        if err != nil {
+            return fmt.Errorf("expires must look like %s, got %s", DateFormat, w.Expires)
+        }
+    }
+    return nil
+}
+
+// Expired reports whether the expiry date has passed, the waiver still applies on the expiry date itself
+func (w *Waiver) Expired(now time.Time) bool {
+    return !w.expires.IsZero() && !now.Before(w.expires.AddDate(0, 0, 1))
+}
+
+// Matches reports whether the waiver covers the component version, expiry aside
+func (w *Waiver) Matches(name, version string) bool {
+    if w.re == nil || !w.re.MatchString(name) {
+        return false
+    }
+    constraint, _ := parseConstraint(w.Versions)
+    return constraint.allows(version)
+}
+
+func (w *Waiver) String() string {
+    description := fmt.Sprintf("%s (owner %s", w.Reason, w.Owner)
+    if w.Ticket != "" {
+        description += ", ticket " + w.Ticket
+    }
+    if w.Expires != "" {
+        description += ", expires " + w.Expires
+    }
+    return description + ")"
+}
+
+// Find returns the first waiver in force for the component version, and the expired waivers that would have matched
+func Find(waivers []Waiver, name, version string, now time.Time) (*Waiver, []*Waiver) {
+    var expired []*Waiver
+    for i := range waivers {
+        w := &waivers[i]
+        if !w.Matches(name, version) {
+            continue
+        }
+        if w.Expired(now) {
+            expired = append(expired, w)
+            continue
+        }
+        return w, expired
+    }
+    return nil, expired
+}
+
+// A constraint is a space separated list of comparisons that all have to hold, e.x. ">=1.2.0 <2.0.0".
+// A bare version means exactly that version, an empty constraint allows every version.
+type constraint []comparison
+
+type comparison struct {
+    operator string
+    version  string
+}
+
+var operators = []string{">=", "<=", "!=", ">", "<", "="}
+
+func parseConstraint(value string) (constraint, error) {
+    var c constraint
+    for _, field := range strings.Fields(value) {
+        operator := "="
+        for _, op := range operators {
+            if strings.HasPrefix(field, op) {
+                operator = op
+                field = strings.TrimPrefix(field, op)
+                break
+            }
+        }
+        if field == "" {
+            return nil, fmt.Errorf("version constraint '%s' is missing a version", value)
+        }
+        c = append(c, comparison{operator, field})
+    }
+    return c, nil
+}
+
+func (c constraint) allows(version string) bool {
+    for _, comparison := range c {
+        // A component without a version can't satisfy a version constraint
+        if version == "" {
+            return false
+        }
+        result := utils.CompareVersions(version, comparison.version)
+        var ok bool
+        switch comparison.operator {
+        case ">=":
+            ok = result >= 0
+        case "<=":
+            ok = result <= 0
+        case "!=":
+            ok = result != 0
+        case ">":
+            ok = result > 0
+        case "<":
+            ok = result < 0
+        default:
+            ok = result == 0
+        }
+        if !ok {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,31 @@
+package waiver
+
+import "testing"
+
+func TestMatchesVersions(t *testing.T) {
+    tests := []struct {
+        versions string
+        version  string
+        want     bool
+    }{
+        {">=1.0.0 <2.0.0", "1.0.0", true},
+        {">=1.0.0 <2.0.0", "1.10.0", true},
+        {">=1.0.0 <2.0.0", "1.9.3", true},
+        {">=1.0.0 <2.0.0", "2.0.0", false},
+        {">=1.0.0 <2.0.0", "0.9.0", false},
+        {">=1.0.0 <2.0.0", "2.0.0-rc.1", true},
+        {"1.2.0", "1.20", false},
+        {"!=1.10.0", "1.1.0", true},
+        {"", "", true},
+        {">=1.0.0", "", false},
+    }
+    for _, test := range tests {
+        w := Waiver{Pattern: "app", Versions: test.versions, Reason: "test", Owner: "team"}
+        if err := w.compile(); err != nil {
+            t.Fatalf("compile %q: %v", test.versions, err)
+        }
+        if got := w.Matches("app", test.version); got != test.want {
+            t.Errorf("versions %q, Matches(%q) = %t, want %t", test.versions, test.version, got, test.want)
+        }
+    }
+}